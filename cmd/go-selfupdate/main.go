@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -11,18 +12,47 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/silthus/go-selfupdate/selfupdate"
 )
 
 var version, genDir string
 var keyFile string
+var ociRef, ociTags string
+var channels string
+var notes, notesFile, notesURL, minOSVersion, releaseDate string
+var mandatory, detectPlatform bool
+var minimumVersion string
+var labels = labelsFlag{}
+
+// labelsFlag collects repeated -label key=value flags.
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	var pairs []string
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("label %q is not in the form key=value", value)
+	}
+	l[kv[0]] = kv[1]
+	return nil
+}
 
 func printUsage() {
 	fmt.Println("")
 	fmt.Println("Positional arguments:")
 	fmt.Println("\tSingle platform: go-selfupdate myapp 1.2")
 	fmt.Println("\tCross platform: go-selfupdate /tmp/mybinares/ 1.2")
+	fmt.Println("\tServe updates: go-selfupdate serve -addr :8080 -d public")
 }
 
 func createBuildDir() {
@@ -44,8 +74,24 @@ func ParseRsaPrivateKeyFromPemStr(privPEM []byte) (*rsa.PrivateKey, error) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
 	flag.StringVar(&genDir, "o", "public", "Output directory for writing updates")
 	flag.StringVar(&keyFile, "k", "", "Private key to use for signing the binary")
+	flag.StringVar(&ociRef, "oci", "", "Also push the update to an OCI registry, e.g. registry.example.com/tools/myapp. Credentials are read from OCI_USERNAME and OCI_PASSWORD")
+	flag.StringVar(&ociTags, "oci-tags", "latest", "Comma separated tags, e.g. channels, pointing at the version pushed with -oci")
+	flag.StringVar(&channels, "channel", "", "Comma separated channels, e.g. stable, pointing at the version in index.json")
+	flag.StringVar(&notes, "notes", "", "Release notes in markdown")
+	flag.StringVar(&notesFile, "notes-file", "", "File to read the release notes in markdown from")
+	flag.StringVar(&notesURL, "notes-url", "", "URL of the full release notes")
+	flag.StringVar(&minOSVersion, "min-os", "", "Oldest supported version of the operating system")
+	flag.StringVar(&releaseDate, "date", "", "Release date in RFC 3339 format. Defaults to now")
+	flag.Var(labels, "label", "Additional metadata in the form key=value. Can be repeated")
+	flag.BoolVar(&mandatory, "mandatory", false, "Require every client to install the update")
+	flag.StringVar(&minimumVersion, "min-version", "", "Require clients older than this version to install the update")
 
 	var defaultPlatform string
 	goos := os.Getenv("GOOS")
@@ -56,7 +102,8 @@ func main() {
 		defaultPlatform = runtime.GOOS + "-" + runtime.GOARCH
 	}
 	platformFlag := flag.String("platform", defaultPlatform,
-		"Target platform in the form OS-ARCH. Defaults to running os/arch or the combination of the environment variables GOOS and GOARCH if both are set.")
+		"Target platform in the form OS-ARCH or OS-ARCH-VARIANT, e.g. linux-amd64-v3 or linux-arm-v7-musl. Defaults to running os/arch or the combination of the environment variables GOOS and GOARCH if both are set. Variants are only published if given, clients not picking variants read the plain OS-ARCH.")
+	flag.BoolVar(&detectPlatform, "detect-platform", false, "Detect the platform from the executable header instead of -platform or the file names of a directory")
 
 	flag.Parse()
 	if flag.NArg() < 2 {
@@ -79,7 +126,30 @@ func main() {
 
 	createBuildDir()
 	version := selfupdate.Info{
-		Version: version,
+		Version:        version,
+		Mandatory:      mandatory,
+		MinimumVersion: minimumVersion,
+		ReleaseNotes:   notes,
+		NotesURL:       notesURL,
+		MinOSVersion:   minOSVersion,
+	}
+	if notesFile != "" {
+		content, err := ioutil.ReadFile(notesFile)
+		if err != nil {
+			panic(err)
+		}
+		version.ReleaseNotes = string(content)
+	}
+	date := time.Now().UTC().Truncate(time.Second)
+	if releaseDate != "" {
+		var err error
+		if date, err = time.Parse(time.RFC3339, releaseDate); err != nil {
+			panic(err)
+		}
+	}
+	version.ReleaseDate = &date
+	if len(labels) > 0 {
+		version.Labels = labels
 	}
 
 	// If dir is given create update for each file
@@ -92,11 +162,76 @@ func main() {
 		files, err := ioutil.ReadDir(appPath)
 		if err == nil {
 			for _, file := range files {
-				selfupdate.CreateUpdate(version, filepath.Join(appPath, file.Name()), file.Name(), genDir, pk)
+				path := filepath.Join(appPath, file.Name())
+				platform := platformOf(path, file.Name())
+				selfupdate.CreateUpdate(version, path, platform, genDir, pk)
+				pushOCI(version, path, platform, pk)
 			}
+			assignChannels(version.Version, pk)
 			os.Exit(0)
 		}
 	}
 
+	platform = platformOf(appPath, platform)
 	selfupdate.CreateUpdate(version, appPath, platform, genDir, pk)
+	pushOCI(version, appPath, platform, pk)
+	assignChannels(version.Version, pk)
+}
+
+func assignChannels(version string, pk *rsa.PrivateKey) {
+	for _, channel := range strings.Split(channels, ",") {
+		if channel = strings.TrimSpace(channel); channel == "" {
+			continue
+		}
+		if err := selfupdate.AssignChannel(genDir, channel, version, pk); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// platformOf returns the platform of the executable at path. It is detected
+// from the header with -detect-platform, otherwise the given platform is
+// checked against the header.
+func platformOf(path, platform string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if detectPlatform {
+		detected, err := selfupdate.DetectPlatform(f)
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", path, err))
+		}
+		// the header can't tell the variant, keep the one of the file name
+		if parts := strings.SplitN(platform, "-", 3); len(parts) == 3 && parts[0]+"-"+parts[1] == detected {
+			return platform
+		}
+		return detected
+	}
+	if err := selfupdate.CheckPlatform(f, platform); err != nil {
+		panic(fmt.Errorf("%s: %v", path, err))
+	}
+	return platform
+}
+
+func pushOCI(version selfupdate.Info, path, platform string, pk *rsa.PrivateKey) {
+	if ociRef == "" {
+		return
+	}
+	registry, err := selfupdate.NewOCIRegistry(ociRef)
+	if err != nil {
+		panic(err)
+	}
+	registry.Username = os.Getenv("OCI_USERNAME")
+	registry.Password = os.Getenv("OCI_PASSWORD")
+	var tags []string
+	for _, tag := range strings.Split(ociTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if err := registry.Push(context.Background(), version, path, platform, pk, tags...); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoints of the server besides the tree. Command names can't start with
+// a dash, so they don't collide with it.
+const (
+	healthPath = "/-/healthz"
+	readyPath  = "/-/readyz"
+	statsPath  = "/-/stats"
+)
+
+// serve runs the serve subcommand with args.
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "Address to listen on")
+	dir := flags.String("d", "public", "Directory created by go-selfupdate to serve")
+	accessLog := flags.Bool("access-log", true, "Log every request to stderr")
+	writeTimeout := flags.Duration("write-timeout", 10*time.Minute, "Maximum time to send a response, e.g. a binary")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: go-selfupdate serve [flags]")
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Endpoints besides the update tree:")
+		fmt.Fprintln(flags.Output(), "\t"+healthPath+"\tliveness")
+		fmt.Fprintln(flags.Output(), "\t"+readyPath+"\treadiness, fails if the directory can't be read")
+		fmt.Fprintln(flags.Output(), "\t"+statsPath+"\tdownloads per command and version as JSON")
+	}
+	_ = flags.Parse(args)
+
+	s := newServer(os.DirFS(*dir))
+	var handler http.Handler = s
+	if *accessLog {
+		handler = logRequests(log.New(os.Stderr, "", log.LstdFlags), handler)
+	}
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		// binaries take a while to send over slow links
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  2 * time.Minute,
+	}
+	log.Printf("serving %s on %s", *dir, *addr)
+	log.Fatal(server.ListenAndServe())
+}
+
+// server serves a tree created by go-selfupdate like a static file server
+// and counts the downloads of each version.
+type server struct {
+	fsys fs.FS
+
+	mu    sync.Mutex
+	etags map[string]etag
+	stats map[string]*cmdStats
+}
+
+// etag is the ETag of a file, valid as long as its size and modification
+// time don't change.
+type etag struct {
+	size    int64
+	modTime time.Time
+	value   string
+}
+
+// cmdStats are the downloads of a command.
+type cmdStats struct {
+	Checks   int64                    // Manifests served.
+	Versions map[string]*versionStats // Downloads by version.
+}
+
+// versionStats are the downloads of a version.
+type versionStats struct {
+	Full  int64 // Full binaries served.
+	Patch int64 // Patches to the version served.
+	Bytes int64 // Bytes of binaries and patches sent.
+}
+
+func newServer(fsys fs.FS) *server {
+	return &server{fsys: fsys, etags: map[string]etag{}, stats: map[string]*cmdStats{}}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case healthPath:
+		fmt.Fprintln(w, "ok")
+		return
+	case readyPath:
+		if _, err := fs.ReadDir(s.fsys, "."); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+		return
+	case statsPath:
+		s.mu.Lock()
+		b, err := json.MarshalIndent(s.stats, "", "  ")
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	h := w.Header()
+	file := name
+	// files compressed ahead of time are sent to clients accepting gzip,
+	// gzipped binaries are sent as they are and unpacked by the client
+	if path.Ext(name) != ".gz" {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) && isFile(s.fsys, name+".gz") {
+			file = name + ".gz"
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	f, err := s.fsys.Open(file)
+	if err != nil {
+		h.Del("Content-Encoding")
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		h.Del("Content-Encoding")
+		http.NotFound(w, r)
+		return
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rs = bytes.NewReader(b)
+	}
+	tag, err := s.etag(file, fi, rs)
+	if err != nil {
+		h.Del("Content-Encoding")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.Set("Content-Type", contentType(name))
+	h.Set("ETag", tag)
+	h.Set("Cache-Control", "no-cache")
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", fi.ModTime(), rs)
+	if r.Method == http.MethodGet {
+		rng := r.Header.Get("Range")
+		s.count(name, cw.status, cw.bytes, rng != "" && !strings.HasPrefix(rng, "bytes=0-"))
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding of r allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isFile(fsys fs.FS, name string) bool {
+	fi, err := fs.Stat(fsys, name)
+	return err == nil && !fi.IsDir()
+}
+
+// etag returns the ETag of file name, hashing it if it changed since it was
+// last hashed.
+func (s *server) etag(name string, fi fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	s.mu.Lock()
+	e, ok := s.etags[name]
+	s.mu.Unlock()
+	if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		return e.value, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	e = etag{size: fi.Size(), modTime: fi.ModTime(), value: `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`}
+	s.mu.Lock()
+	s.etags[name] = e
+	s.mu.Unlock()
+	return e.value, nil
+}
+
+// count counts a file sent with status. Ranges continuing a download are
+// only counted as bytes.
+func (s *server) count(name string, status int, n int64, ranged bool) {
+	if status != http.StatusOK && status != http.StatusPartialContent {
+		return
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := s.stats[parts[0]]
+	if cmd == nil {
+		cmd = &cmdStats{Versions: map[string]*versionStats{}}
+		s.stats[parts[0]] = cmd
+	}
+	version := func(v string) *versionStats {
+		stats := cmd.Versions[v]
+		if stats == nil {
+			stats = &versionStats{}
+			cmd.Versions[v] = stats
+		}
+		return stats
+	}
+	switch {
+	case len(parts) == 2 && strings.HasSuffix(name, ".json") && parts[1] != "index.json":
+		cmd.Checks++
+	case len(parts) == 3 && strings.HasSuffix(name, ".gz"):
+		// cmd/version/platform.gz
+		v := version(parts[1])
+		v.Bytes += n
+		if !ranged {
+			v.Full++
+		}
+	case len(parts) == 4:
+		// cmd/from/to/platform
+		v := version(parts[2])
+		v.Bytes += n
+		if !ranged {
+			v.Patch++
+		}
+	}
+}
+
+// contentType returns the type of the files of the tree.
+func contentType(name string) string {
+	switch path.Ext(name) {
+	case ".json":
+		return "application/json"
+	case ".gz":
+		return "application/gzip"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	// binaries, patches and signatures
+	return "application/octet-stream"
+}
+
+// countingWriter records the status and the body size of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// logRequests logs every request handled by h to l.
+func logRequests(l *log.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		l.Printf("%s %s %s %d %d %v %q", r.RemoteAddr, r.Method, r.URL.RequestURI(), cw.status, cw.bytes, time.Since(start).Round(time.Millisecond), r.UserAgent())
+	})
+}
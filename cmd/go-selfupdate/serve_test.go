@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/silthus/go-selfupdate/selfupdate"
+)
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	genDir := filepath.Join(dir, "public", "myapp")
+	os.MkdirAll(genDir, 0755)
+	for _, version := range []string{"1.2", "1.3"} {
+		path := filepath.Join(dir, "myapp-"+version)
+		ioutil.WriteFile(path, bytes.Repeat([]byte("binary "+version+" "), 100), 0755)
+		selfupdate.CreateUpdate(selfupdate.Info{Version: version}, path, "linux-amd64", genDir, nil)
+	}
+
+	var accessLog bytes.Buffer
+	s := newServer(os.DirFS(filepath.Join(dir, "public")))
+	server := httptest.NewServer(logRequests(log.New(&accessLog, "", 0), s))
+	defer server.Close()
+
+	target := filepath.Join(dir, "myapp")
+	ioutil.WriteFile(target, bytes.Repeat([]byte("binary 1.2 "), 100), 0755)
+	for _, name := range []string{"DISABLE", "CHANNEL", "PIN", "URL", "MIRRORS", "CHECK_TIME"} {
+		t.Setenv("MYAPP_SELFUPDATE_"+name, "")
+	}
+	updater := &selfupdate.Updater{
+		CurrentVersion: "1.2",
+		ApiURL:         server.URL + "/",
+		BinURL:         server.URL + "/",
+		DiffURL:        server.URL + "/",
+		Dir:            "update/",
+		CmdName:        "myapp",
+		Platform:       "linux-amd64",
+		Target:         target,
+		PolicyFile:     filepath.Join(dir, "policy.json"),
+	}
+	check, err := updater.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.PatchAvailable || check.Size <= 0 {
+		t.Errorf("expected the sizes of the patch and binary, got %#v", check)
+	}
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.3" {
+		t.Fatalf("expected 1.3 to be installed, got %q", info.Version)
+	}
+	if !strings.Contains(accessLog.String(), "GET /myapp/1.2/1.3/linux-amd64 200") {
+		t.Errorf("expected the patch download to be logged, got\n%s", accessLog.String())
+	}
+
+	// full binaries are sent gzipped as they are
+	resp := get(t, server.URL+"/myapp/1.3/linux-amd64.gz", nil)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("expected application/gzip, got %q", ct)
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("expected no Content-Encoding, got %q", enc)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	if resp = get(t, server.URL+"/myapp/1.3/linux-amd64.gz", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", resp.StatusCode)
+	}
+	resp = get(t, server.URL+"/myapp/1.3/linux-amd64.gz", http.Header{"Range": {"bytes=2-5"}})
+	if body, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != http.StatusPartialContent || len(body) != 4 {
+		t.Errorf("expected 4 bytes of partial content, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+
+	// manifests compressed ahead of time are sent to clients accepting gzip
+	manifest, _ := ioutil.ReadFile(filepath.Join(genDir, "linux-amd64.json"))
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(manifest)
+	w.Close()
+	ioutil.WriteFile(filepath.Join(genDir, "linux-amd64.json.gz"), compressed.Bytes(), 0644)
+	resp = get(t, server.URL+"/myapp/linux-amd64.json", http.Header{"Accept-Encoding": {"gzip"}})
+	if ct, enc := resp.Header.Get("Content-Type"), resp.Header.Get("Content-Encoding"); ct != "application/json" || enc != "gzip" {
+		t.Errorf("expected gzipped JSON, got %q encoded as %q", ct, enc)
+	}
+	resp = get(t, server.URL+"/myapp/linux-amd64.json", http.Header{"Accept-Encoding": {"gzip;q=0"}})
+	if body, _ := ioutil.ReadAll(resp.Body); !bytes.Equal(body, manifest) {
+		t.Errorf("expected the plain manifest, got %q", body)
+	}
+
+	if resp = get(t, server.URL+"/myapp/1.4/linux-amd64.gz", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing version, got %d", resp.StatusCode)
+	}
+	if resp = get(t, server.URL+"/myapp/", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a directory, got %d", resp.StatusCode)
+	}
+	for _, path := range []string{healthPath, readyPath} {
+		if resp = get(t, server.URL+path, nil); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %s to succeed, got %d", path, resp.StatusCode)
+		}
+	}
+
+	var stats map[string]cmdStats
+	if err := json.NewDecoder(get(t, server.URL+statsPath, nil).Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	v := stats["myapp"].Versions["1.3"]
+	if stats["myapp"].Checks != 4 || v == nil || v.Patch != 1 || v.Full != 1 {
+		t.Errorf("expected 4 checks and a patch and a full download of 1.3, got %+v %+v", stats["myapp"], v)
+	}
+}
+
+func get(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	// keep the transport from unpacking gzipped responses
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
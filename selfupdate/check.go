@@ -0,0 +1,132 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// UpdateCheckResult describes the newest version found by Check.
+type UpdateCheckResult struct {
+	CurrentVersion string // Version currently running.
+	Version        string // Newest version available, empty if there is none for the platform.
+	Newer          bool   // Version is newer than CurrentVersion.
+	PatchAvailable bool   // A patch from CurrentVersion to Version is available.
+	PatchSize      int64  // Download size of the patch, -1 if unknown.
+	Size           int64  // Download size of the full binary, -1 if unknown.
+	Mandatory      bool   // Every client must install the update.
+	Required       bool   // The update must be installed, see UpdateRequired.
+	Skipped        bool   // Version was skipped by a consent callback.
+	ReleaseNotes   string // Notes of the release in markdown.
+	Source         string // Mirror URL or Source the manifest was read from.
+	Info           Info   // The manifest of Version.
+}
+
+// Check looks for an update without installing it.
+//
+// Besides the manifest, it looks up the sizes of the patch and the full
+// binary if the version differs from CurrentVersion. Sizes listed in the
+// manifest are used as they are. Otherwise they are asked with
+// HEAD requests from URLs and read from the file system for an FSSource.
+// Other sources are asked for the patch, which is downloaded to find out its
+// size, and the size of the full binary is unknown. Failing to look up a
+// size leaves it unknown, only failing to read the manifest is an error.
+//
+// With Pin the newest version matching it is reported, which may be older
+// than CurrentVersion.
+func (u *Updater) Check() (UpdateCheckResult, error) {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return UpdateCheckResult{}, err
+	}
+	ctx := context.Background()
+	info, from, err := u.fetchInfoFrom(ctx)
+	if err != nil {
+		return UpdateCheckResult{}, err
+	}
+	if u.Pin != "" {
+		if info, err = u.pinnedInfo(info); err != nil {
+			return UpdateCheckResult{}, err
+		}
+	}
+	result := UpdateCheckResult{
+		CurrentVersion: u.CurrentVersion,
+		Version:        info.Version,
+		Newer:          info.Version != "" && compareVersions(info.Version, u.CurrentVersion) > 0,
+		PatchSize:      -1,
+		Size:           -1,
+		Mandatory:      info.Mandatory,
+		Required:       isRequired(info, u.CurrentVersion),
+		Skipped:        info.Version != "" && u.isSkipped(info),
+		ReleaseNotes:   info.ReleaseNotes,
+		Source:         from,
+		Info:           info,
+	}
+	if info.Version == "" || info.Version == u.CurrentVersion {
+		return result, nil
+	}
+
+	platform := u.platformFor(info)
+	// manifests written by CreateUpdate list the sizes of all patches
+	if size, ok := info.PatchSizes[u.CurrentVersion]; ok {
+		result.PatchAvailable, result.PatchSize = true, size
+	} else if info.PatchSizes == nil {
+		_ = u.tryMirrors(u.DiffURL, u.DiffMirrors, func(s Source) error {
+			size, err := patchSize(u.withDownload(ctx, DownloadPatch), unwrapSource(s), u.CmdName, u.CurrentVersion, info.Version, platform)
+			if err != nil {
+				return err
+			}
+			result.PatchAvailable, result.PatchSize = true, size
+			return nil
+		})
+	}
+	if info.Size > 0 {
+		result.Size = info.Size
+	} else {
+		_ = u.tryMirrors(u.BinURL, u.BinMirrors, func(s Source) error {
+			if sized, ok := unwrapSource(s).(SizeSource); ok {
+				size, err := sized.BinSize(ctx, u.CmdName, info.Version, platform)
+				if err != nil {
+					return err
+				}
+				result.Size = size
+			}
+			return nil
+		})
+	}
+	return result, nil
+}
+
+// patchSize returns the size of a patch, downloading it if s can't tell.
+func patchSize(ctx context.Context, s Source, cmdName, from, to, platform string) (int64, error) {
+	if sized, ok := s.(SizeSource); ok {
+		return sized.PatchSize(ctx, cmdName, from, to, platform)
+	}
+	r, err := s.FetchPatch(ctx, cmdName, from, to, platform)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(ioutil.Discard, r)
+}
+
+// unwrapSource returns the Source of a mirror.
+func unwrapSource(s Source) Source {
+	if m, ok := s.(mirrorSource); ok {
+		return m.Source
+	}
+	return s
+}
+
+// sourceName returns the URL of a mirror, or describes a configured Source.
+func sourceName(s Source) string {
+	if m, ok := s.(mirrorSource); ok && m.url != "" {
+		return m.url
+	}
+	s = unwrapSource(s)
+	if stringer, ok := s.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", s)
+}
@@ -0,0 +1,64 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdaterCheckAndDryRun(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	oldBin := bytes.Repeat([]byte("old binary "), 100)
+	newBin := append(bytes.Repeat([]byte("old binary "), 90), []byte("new binary")...)
+	release.publish(Info{Version: "1.2", ReleaseNotes: "Release 1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3", ReleaseNotes: "Release 1.3"}, "linux-amd64", newBin)
+
+	updater := release.updater("1.2", oldBin)
+	url := release.serve(updater, release.files())
+	result, err := updater.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, _ := os.Stat(filepath.Join(release.genDir, "1.2", "1.3", "linux-amd64"))
+	full, _ := os.Stat(filepath.Join(release.genDir, "1.3", "linux-amd64.gz"))
+	equals(t, "1.2", result.CurrentVersion)
+	equals(t, "1.3", result.Version)
+	equals(t, true, result.Newer)
+	equals(t, true, result.PatchAvailable)
+	equals(t, patch.Size(), result.PatchSize)
+	equals(t, full.Size(), result.Size)
+	equals(t, "Release 1.3", result.ReleaseNotes)
+	equals(t, url, result.Source)
+	equals(t, patch.Size(), result.Info.PatchSizes["1.2"])
+	equals(t, full.Size(), result.Info.Size)
+
+	updater.CurrentVersion = "1.1"
+	if result, err = updater.Check(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, false, result.PatchAvailable)
+	equals(t, int64(-1), result.PatchSize)
+
+	updater.CurrentVersion = "1.2"
+	updater.DryRun = true
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	if bin, _ := ioutil.ReadFile(updater.Target); !bytes.Equal(oldBin, bin) {
+		t.Error("expected a dry run not to replace the target")
+	}
+	if installed, err := updater.InstalledInfo(); err != nil || installed.Version != "" {
+		t.Errorf("expected nothing to be installed, got %#v %v", installed, err)
+	}
+
+	updater.writeInstalledInfo(info)
+	installed, err := updater.InstalledInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "Release 1.3", installed.ReleaseNotes)
+}
@@ -0,0 +1,124 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const skippedPath = "skipped.json"
+
+// ErrAborted is returned if a consent callback aborted the update.
+var ErrAborted = errors.New("update: aborted")
+
+// ConsentAction is the decision of a consent callback.
+type ConsentAction int
+
+const (
+	// ConsentApprove continues the update.
+	ConsentApprove ConsentAction = iota
+	// ConsentDefer stops the update and checks again at Until.
+	ConsentDefer
+	// ConsentSkip stops the update and ignores its version from now on.
+	ConsentSkip
+	// ConsentAbort stops the update with ErrAborted.
+	ConsentAbort
+)
+
+// Consent is returned by a ConsentFunc. The zero value approves.
+type Consent struct {
+	Action ConsentAction
+	Until  time.Time // Time to check again if Action is ConsentDefer.
+}
+
+// ConsentFunc is called with the manifest of an update to approve, defer,
+// skip or abort it.
+//
+// Required updates, see UpdateRequired, can't be deferred or skipped, both
+// approve them. They can still be aborted, e.g. while jobs are running.
+type ConsentFunc func(info Info) Consent
+
+// Approve continues the update.
+func Approve() Consent {
+	return Consent{Action: ConsentApprove}
+}
+
+// DeferUntil stops the update and checks again at t.
+func DeferUntil(t time.Time) Consent {
+	return Consent{Action: ConsentDefer, Until: t}
+}
+
+// SkipVersion stops the update and ignores its version from now on.
+func SkipVersion() Consent {
+	return Consent{Action: ConsentSkip}
+}
+
+// Abort stops the update with ErrAborted.
+func Abort() Consent {
+	return Consent{Action: ConsentAbort}
+}
+
+// consent asks callback about the update to info and reports whether to
+// continue.
+func (u *Updater) consent(callback ConsentFunc, info Info) (bool, error) {
+	if callback == nil {
+		return true, nil
+	}
+	c := callback(info)
+	if c.Action == ConsentAbort {
+		return false, ErrAborted
+	}
+	if isRequired(info, u.CurrentVersion) {
+		return true, nil
+	}
+	switch c.Action {
+	case ConsentDefer:
+		writeTime(u.getExecRelativeDir(u.Dir+upcktimePath), c.Until)
+		return false, nil
+	case ConsentSkip:
+		return false, u.skipVersion(info.Version)
+	}
+	return true, nil
+}
+
+// SkippedVersions returns the versions skipped by a consent callback.
+func (u *Updater) SkippedVersions() []string {
+	var versions []string
+	b, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + skippedPath))
+	if err == nil {
+		_ = json.Unmarshal(b, &versions)
+	}
+	return versions
+}
+
+// ClearSkippedVersions forgets all versions skipped by a consent callback.
+func (u *Updater) ClearSkippedVersions() error {
+	err := os.Remove(u.getExecRelativeDir(u.Dir + skippedPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// isSkipped reports whether version was skipped and isn't required.
+func (u *Updater) isSkipped(info Info) bool {
+	if isRequired(info, u.CurrentVersion) {
+		return false
+	}
+	for _, v := range u.SkippedVersions() {
+		if v == info.Version {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *Updater) skipVersion(version string) error {
+	b, err := json.Marshal(append(u.SkippedVersions(), version))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(u.getExecRelativeDir(u.Dir+skippedPath), b, 0644)
+}
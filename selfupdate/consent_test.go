@@ -0,0 +1,72 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestUpdaterConsent(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	oldBin, newBin := []byte("old binary"), []byte("new binary")
+	release.publish(Info{Version: "1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3"}, "linux-amd64", newBin)
+
+	updater := release.updater("1.2", oldBin)
+	var found []string
+	updater.OnUpdateFound = func(info Info) Consent {
+		found = append(found, info.Version)
+		return SkipVersion()
+	}
+	if info, err := updater.Update(); err != nil || info.Version != "" {
+		t.Errorf("expected the update to be skipped, got %#v %v", info, err)
+	}
+	equals(t, 1, len(updater.SkippedVersions()))
+	equals(t, "1.3", updater.SkippedVersions()[0])
+	if info, err := updater.Update(); err != nil || info.Version != "" {
+		t.Errorf("expected the skipped version to be ignored, got %#v %v", info, err)
+	}
+	equals(t, 1, len(found))
+	if version, err := updater.UpdateAvailable(); err != nil || version != "" {
+		t.Errorf("expected no update available for the skipped version, got %q %v", version, err)
+	}
+	if info, err := updater.GetNextVersion(); err != nil || info.Version != "" {
+		t.Errorf("expected no next version for the skipped version, got %#v %v", info, err)
+	}
+	result, err := updater.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, true, result.Skipped)
+	if err := updater.ClearSkippedVersions(); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	updater.OnUpdateFound = nil
+	updater.BeforeDownload = func(info Info) Consent {
+		return DeferUntil(until)
+	}
+	if info, err := updater.Update(); err != nil || info.Version != "" {
+		t.Errorf("expected the update to be deferred, got %#v %v", info, err)
+	}
+	equals(t, true, updater.NextUpdate().Equal(until))
+
+	updater.BeforeDownload = nil
+	updater.BeforeInstall = func(info Info) Consent {
+		return Abort()
+	}
+	if _, err := updater.Update(); err != ErrAborted {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+	if bin, _ := ioutil.ReadFile(updater.Target); !bytes.Equal(oldBin, bin) {
+		t.Error("expected an aborted update not to replace the target")
+	}
+
+	// required updates can't be skipped
+	if ok, err := updater.consent(func(Info) Consent { return SkipVersion() }, Info{Version: "1.3", Mandatory: true}); !ok || err != nil {
+		t.Errorf("expected a mandatory update to continue, got %v %v", ok, err)
+	}
+	equals(t, 0, len(updater.SkippedVersions()))
+}
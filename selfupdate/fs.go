@@ -0,0 +1,118 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+)
+
+// FSSource is a Source reading the layout written by go-selfupdate from a
+// file system, e.g. a share mounted at sites without network access:
+//
+//  CmdName/platform.json
+//  CmdName/version/platform.gz
+//  CmdName/from/to/platform
+//
+// Example:
+//
+//  source, err := selfupdate.NewFileSource("file:///mnt/updates/")
+//  if err != nil {
+//  	log.Fatal(err)
+//  }
+//  updater := &selfupdate.Updater{
+//  	CurrentVersion: version,
+//  	Dir:            "update/",
+//  	CmdName:        "myapp",
+//  	Source:         source,
+//  }
+type FSSource struct {
+	FS fs.FS // File system containing a directory per CmdName.
+}
+
+// NewFileSource returns a source reading from a directory given as path or
+// as file:// URL.
+func NewFileSource(dirOrURL string) (*FSSource, error) {
+	dir := dirOrURL
+	if u, err := url.Parse(dirOrURL); err == nil && u.Scheme == "file" {
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("file URL %s must not have a host", dirOrURL)
+		}
+		dir = u.Path
+		// file:///C:/updates has the path /C:/updates
+		if runtime.GOOS == "windows" && len(dir) > 2 && dir[0] == '/' && dir[2] == ':' {
+			dir = dir[1:]
+		}
+		dir = filepath.FromSlash(dir)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &FSSource{FS: os.DirFS(dir)}, nil
+}
+
+func (s *FSSource) FetchIndex(ctx context.Context, cmdName string) ([]byte, []byte, error) {
+	index, err := fs.ReadFile(s.FS, path.Join(cmdName, indexPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := fs.ReadFile(s.FS, path.Join(cmdName, indexSignaturePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	return index, sig, nil
+}
+
+func (s *FSSource) FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error) {
+	f, err := s.FS.Open(path.Join(cmdName, platform+".json"))
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	return decodeInfo(f)
+}
+
+func (s *FSSource) FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error) {
+	f, err := s.FS.Open(path.Join(cmdName, from, to, platform))
+	if os.IsNotExist(err) {
+		return nil, ErrNoPatch
+	}
+	return f, err
+}
+
+func (s *FSSource) FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error) {
+	f, err := s.FS.Open(path.Join(cmdName, version, platform+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	return gunzip(f)
+}
+
+func (s *FSSource) PatchSize(ctx context.Context, cmdName, from, to, platform string) (int64, error) {
+	fi, err := fs.Stat(s.FS, path.Join(cmdName, from, to, platform))
+	if os.IsNotExist(err) {
+		return 0, ErrNoPatch
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *FSSource) BinSize(ctx context.Context, cmdName, version, platform string) (int64, error) {
+	fi, err := fs.Stat(s.FS, path.Join(cmdName, version, platform+".gz"))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
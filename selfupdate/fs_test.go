@@ -0,0 +1,56 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSSourceReadsCreateUpdateLayout(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	oldBin := bytes.Repeat([]byte("old binary "), 100)
+	newBin := append(bytes.Repeat([]byte("old binary "), 90), []byte("new binary")...)
+	release.publish(Info{Version: "1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3"}, "linux-amd64", newBin)
+
+	source, err := NewFileSource("file://" + filepath.ToSlash(filepath.Join(release.dir, "public")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater := release.updater("1.2", oldBin)
+	updater.Source = source
+	info, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+
+	bin, err := updater.fetchAndVerifyPatch(context.Background(), info, bytes.NewReader(oldBin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, string(newBin), string(bin))
+	bin, err = updater.fetchAndVerifyFullBin(context.Background(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, string(newBin), string(bin))
+
+	updater.CurrentVersion = "1.1"
+	if _, err := updater.fetchAndVerifyPatch(context.Background(), info, bytes.NewReader(oldBin)); err != ErrNoPatch {
+		t.Errorf("expected ErrNoPatch, got %v", err)
+	}
+}
+
+func TestFSSourceMissingManifest(t *testing.T) {
+	updater := &Updater{CurrentVersion: "1.2", CmdName: "myapp", Platform: "linux-amd64", Source: &FSSource{FS: fstest.MapFS{}}}
+	if _, err := updater.GetNextVersion(); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := NewFileSource("file://remote/updates"); err == nil {
+		t.Error("expected an error for a file URL with host")
+	}
+}
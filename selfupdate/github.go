@@ -0,0 +1,338 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultGitHubURL       = "https://api.github.com/"
+	defaultAssetName       = "{{.CmdName}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.Variant}}{{.Ext}}"
+	defaultChecksumsName   = "checksums.txt"
+	defaultSignatureSuffix = ".sig"
+	defaultTagPrefix       = "v"
+)
+
+// GitHubSource is a Source reading releases through the GitHub REST API.
+//
+// The asset of a platform is found by executing AssetName, a text/template
+// receiving an AssetNameData. An asset with an additional ".gz" extension is
+// decompressed after download. The hash of the uncompressed binary is read
+// from the checksums file of the release, in the sha256sum format written by
+// goreleaser. If the release contains an asset named like the binary plus
+// SignatureSuffix, its content is used as signature checked with
+// Updater.PublicKey.
+//
+// Example:
+//
+//  updater := &selfupdate.Updater{
+//  	CurrentVersion: version,
+//  	CmdName:        "myapp",
+//  	Dir:            "update/",
+//  	Source: &selfupdate.GitHubSource{
+//  		Owner: "yourorg",
+//  		Repo:  "myapp",
+//  		Token: os.Getenv("GITHUB_TOKEN"),
+//  	},
+//  }
+type GitHubSource struct {
+	Owner           string         // Owner of the repository.
+	Repo            string         // Name of the repository.
+	BaseURL         string         // Optional API URL, e.g. https://github.example.com/api/v3/ for GitHub Enterprise. Defaults to https://api.github.com/
+	Token           string         // Optional token used to authenticate API requests
+	AssetName       string         // Optional template for the asset name. Defaults to "{{.CmdName}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.Variant}}{{.Ext}}"
+	ChecksumsName   string         // Optional name of the checksums asset. Defaults to checksums.txt
+	SignatureSuffix string         // Optional suffix of signature assets. Defaults to .sig
+	TagPrefix       string         // Optional prefix removed from tags to get the version. Defaults to v
+	Requester       *HTTPRequester // Optional requester to configure timeouts, proxies or TLS
+}
+
+// AssetNameData is passed to the AssetName template of a release source.
+type AssetNameData struct {
+	CmdName  string // Command name of the Updater.
+	Version  string // Version without tag prefix.
+	Platform string // Platform like linux-amd64.
+	OS       string // Operating system part of the platform.
+	Arch     string // Architecture part of the platform.
+	Variant  string // Variant part of the platform like v3 or v7-musl, empty for most platforms.
+	Ext      string // ".exe" on windows, empty otherwise.
+}
+
+type gitHubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	Body        string        `json:"body"`
+	HTMLURL     string        `json:"html_url"`
+	PublishedAt *time.Time    `json:"published_at"`
+	Assets      []gitHubAsset `json:"assets"`
+}
+
+type gitHubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+func (s *GitHubSource) String() string {
+	return s.baseURL() + "repos/" + s.Owner + "/" + s.Repo
+}
+
+// FetchInfo returns the latest release. If channel is set, the newest
+// release that is either stable or a prerelease tagged with the channel
+// name, like v1.3.0-beta.1 for channel beta, is returned instead.
+func (s *GitHubSource) FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error) {
+	release, err := s.latestRelease(ctx, channel)
+	if err != nil {
+		return Info{}, err
+	}
+	if release == nil {
+		return Info{}, nil
+	}
+	version := strings.TrimPrefix(release.TagName, s.tagPrefix())
+	name, err := assetName(s.AssetName, cmdName, version, platform)
+	if err != nil {
+		return Info{}, err
+	}
+	asset := findAsset(release.Assets, name, name+".gz")
+	if asset == nil {
+		return Info{}, notExist("release %s has no asset %s", release.TagName, name)
+	}
+	checksums := findAsset(release.Assets, s.checksumsName())
+	if checksums == nil {
+		return Info{}, notExist("release %s has no asset %s", release.TagName, s.checksumsName())
+	}
+	r, err := s.download(ctx, checksums)
+	if err != nil {
+		return Info{}, err
+	}
+	defer r.Close()
+	sha, err := findChecksum(r, name)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{
+		Version:      version,
+		Sha256:       sha,
+		ReleaseDate:  release.PublishedAt,
+		ReleaseNotes: release.Body,
+		NotesURL:     release.HTMLURL,
+		Size:         asset.Size,
+	}
+	if sig := findAsset(release.Assets, name+s.signatureSuffix()); sig != nil {
+		r, err := s.download(ctx, sig)
+		if err != nil {
+			return Info{}, err
+		}
+		defer r.Close()
+		if info.Signature, err = readSignature(r); err != nil {
+			return Info{}, err
+		}
+	}
+	return info, nil
+}
+
+// FetchPatch always returns ErrNoPatch since GitHub releases carry no patches.
+func (s *GitHubSource) FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error) {
+	return nil, ErrNoPatch
+}
+
+// FetchBin downloads the asset of the release tagged with version.
+func (s *GitHubSource) FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error) {
+	release := &gitHubRelease{}
+	if err := s.getJSON(ctx, "releases/tags/"+url.PathEscape(s.tagPrefix()+version), release); err != nil {
+		return nil, err
+	}
+	name, err := assetName(s.AssetName, cmdName, version, platform)
+	if err != nil {
+		return nil, err
+	}
+	asset := findAsset(release.Assets, name, name+".gz")
+	if asset == nil {
+		return nil, notExist("release %s has no asset %s", release.TagName, name)
+	}
+	r, err := s.download(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Name != name {
+		return gunzip(r)
+	}
+	return r, nil
+}
+
+func (s *GitHubSource) latestRelease(ctx context.Context, channel string) (*gitHubRelease, error) {
+	if channel == "" {
+		release := &gitHubRelease{}
+		return release, s.getJSON(ctx, "releases/latest", release)
+	}
+	var releases []*gitHubRelease
+	if err := s.getJSON(ctx, "releases", &releases); err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.Draft {
+			continue
+		}
+		if !release.Prerelease || strings.Contains(release.TagName, "-"+channel) {
+			return release, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *GitHubSource) getJSON(ctx context.Context, path string, v interface{}) error {
+	u := s.String() + "/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	r, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (s *GitHubSource) download(ctx context.Context, asset *gitHubAsset) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	return s.do(req)
+}
+
+func (s *GitHubSource) do(req *http.Request) (io.ReadCloser, error) {
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	if s.Requester == nil {
+		return (&HTTPRequester{}).do(req)
+	}
+	return s.Requester.do(req)
+}
+
+func (s *GitHubSource) baseURL() string {
+	if s.BaseURL == "" {
+		return defaultGitHubURL
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/"
+}
+
+func (s *GitHubSource) tagPrefix() string {
+	if s.TagPrefix == "" {
+		return defaultTagPrefix
+	}
+	return s.TagPrefix
+}
+
+func (s *GitHubSource) checksumsName() string {
+	if s.ChecksumsName == "" {
+		return defaultChecksumsName
+	}
+	return s.ChecksumsName
+}
+
+func (s *GitHubSource) signatureSuffix() string {
+	if s.SignatureSuffix == "" {
+		return defaultSignatureSuffix
+	}
+	return s.SignatureSuffix
+}
+
+func findAsset(assets []gitHubAsset, names ...string) *gitHubAsset {
+	for _, name := range names {
+		for i := range assets {
+			if assets[i].Name == name {
+				return &assets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// assetName executes the asset name template tmpl, or the default template
+// if tmpl is empty, for the given release. Variants of platforms are
+// missing if tmpl doesn't use the variant, instead of matching the asset
+// of the plain platform.
+func assetName(tmpl, cmdName, version, platform string) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultAssetName
+	}
+	if _, variant := splitVariant(platform); variant != "" && !strings.Contains(tmpl, ".Variant") {
+		return "", notExist("asset name %q has no variant for %s", tmpl, platform)
+	}
+	t, err := template.New("asset").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	data := AssetNameData{CmdName: cmdName, Version: version, Platform: platform}
+	data.OS, data.Arch = splitPlatform(platform)
+	_, data.Variant = splitVariant(platform)
+	if data.OS == "windows" {
+		data.Ext = ".exe"
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// splitPlatform splits a platform like linux-amd64 into OS and architecture.
+// A variant like v3 of linux-amd64-v3 is dropped, see splitVariant.
+func splitPlatform(platform string) (string, string) {
+	parts := strings.SplitN(platform, "-", 3)
+	if len(parts) < 2 {
+		return platform, ""
+	}
+	return parts[0], parts[1]
+}
+
+// findChecksum returns the SHA-256 hash of name listed in a checksums file
+// in the format of sha256sum.
+func findChecksum(r io.Reader, name string) ([]byte, error) {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sum, ok := sums[name]
+	if !ok {
+		return nil, notExist("no checksum for %s", name)
+	}
+	return hex.DecodeString(sum)
+}
+
+// readSignature reads a raw or base64 encoded signature.
+func readSignature(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b))); err == nil {
+		return sig, nil
+	}
+	return b, nil
+}
@@ -0,0 +1,196 @@
+package selfupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"runtime"
+	"testing"
+)
+
+// newTestGitHub serves the releases of owner/myapp like the GitHub REST API.
+// Binaries are uploaded gzipped to exercise decompression.
+func newTestGitHub(t *testing.T, bin []byte, pk *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	sha := sha256.Sum256(bin)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(bin)
+	w.Close()
+	var sig []byte
+	if pk != nil {
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, sha[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := func(version string) map[string][]byte {
+		name := "myapp_" + version + "_linux_amd64"
+		f := map[string][]byte{
+			name + ".gz":    gz.Bytes(),
+			"checksums.txt": []byte(fmt.Sprintf("%x  %s\n%x  other\n", sha, name, sha256.Sum256(nil))),
+		}
+		if sig != nil {
+			f[name+".sig"] = sig
+		}
+		return f
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	release := func(tag string, prerelease bool) gitHubRelease {
+		r := gitHubRelease{TagName: tag, Prerelease: prerelease, Body: "Notes of " + tag}
+		for n, b := range files(tag[1:]) {
+			r.Assets = append(r.Assets, gitHubAsset{Name: n, URL: srv.URL + "/assets/" + tag[1:] + "/" + n, Size: int64(len(b))})
+		}
+		return r
+	}
+	reply := func(v interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(v)
+		}
+	}
+	mux.Handle("/api/v3/repos/owner/myapp/releases/latest", reply(release("v1.3.0", false)))
+	mux.Handle("/api/v3/repos/owner/myapp/releases/tags/v1.3.0", reply(release("v1.3.0", false)))
+	mux.Handle("/api/v3/repos/owner/myapp/releases", reply([]gitHubRelease{
+		{TagName: "v1.5.0-rc.1", Draft: true},
+		release("v1.4.0-beta.1", true),
+		release("v1.3.0", false),
+	}))
+	mux.HandleFunc("/assets/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		version, name := path.Split(r.URL.Path[len("/assets/"):])
+		w.Write(files(path.Clean(version))[name])
+	})
+	return srv
+}
+
+func TestGitHubSourceLatestRelease(t *testing.T) {
+	bin := []byte("new binary")
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestGitHub(t, bin, pk)
+	defer srv.Close()
+
+	updater := &Updater{
+		CurrentVersion: "1.2.0",
+		CmdName:        "myapp",
+		Platform:       "linux-amd64",
+		PublicKey:      &pk.PublicKey,
+		Source:         &GitHubSource{Owner: "owner", Repo: "myapp", BaseURL: srv.URL + "/api/v3", Token: "token"},
+	}
+	info, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3.0", info.Version)
+	sha := sha256.Sum256(bin)
+	equals(t, hex.EncodeToString(sha[:]), hex.EncodeToString(info.Sha256))
+	equals(t, "Notes of v1.3.0", info.ReleaseNotes)
+
+	got, err := updater.fetchAndVerifyFullBin(context.Background(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, string(bin), string(got))
+
+	if _, err := updater.fetchAndVerifyPatch(context.Background(), info, bytes.NewReader(nil)); err != ErrNoPatch {
+		t.Errorf("expected ErrNoPatch, got %v", err)
+	}
+}
+
+func TestGitHubSourceChannel(t *testing.T) {
+	srv := newTestGitHub(t, []byte("new binary"), nil)
+	defer srv.Close()
+
+	s := &GitHubSource{Owner: "owner", Repo: "myapp", BaseURL: srv.URL + "/api/v3/", Token: "token"}
+	info, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64", "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4.0-beta.1", info.Version)
+	if info.Signature != nil {
+		t.Error("expected no signature")
+	}
+
+	info, err = s.FetchInfo(context.Background(), "myapp", "linux-amd64", "rc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3.0", info.Version)
+
+	if _, err := s.FetchInfo(context.Background(), "myapp", "windows-amd64", ""); err == nil {
+		t.Error("expected an error for a missing asset")
+	}
+}
+
+func TestGitHubSourceVariants(t *testing.T) {
+	srv := newTestGitHub(t, []byte("new binary"), nil)
+	defer srv.Close()
+
+	name, err := assetName("", "myapp", "1.3.0", "linux-amd64-v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "myapp_1.3.0_linux_amd64v3", name)
+
+	s := &GitHubSource{Owner: "owner", Repo: "myapp", BaseURL: srv.URL + "/api/v3/", Token: "token"}
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64-v3", ""); !isMissing(err) {
+		t.Errorf("expected a missing asset, got %v", err)
+	}
+	s.AssetName = "{{.CmdName}}_{{.Version}}_{{.OS}}_{{.Arch}}"
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64-v3", ""); !isMissing(err) {
+		t.Errorf("expected the variant to be missing without .Variant in the asset name, got %v", err)
+	}
+	s.ChecksumsName = "sha256sums.txt"
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64", ""); !isMissing(err) {
+		t.Errorf("expected missing checksums, got %v", err)
+	}
+
+	if runtime.GOOS+"-"+runtime.GOARCH != "linux-amd64" {
+		t.Skip("variants are only looked up for the platform of the host")
+	}
+	defer func(detect func() ([]string, string)) { hostVariants = detect }(hostVariants)
+	hostVariants = func() ([]string, string) { return []string{"v3", "v2"}, "" }
+	updater := &Updater{
+		CurrentVersion: "1.2.0",
+		CmdName:        "myapp",
+		Variants:       true,
+		Source:         &GitHubSource{Owner: "owner", Repo: "myapp", BaseURL: srv.URL + "/api/v3", Token: "token"},
+	}
+	info, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3.0", info.Version)
+	equals(t, "linux-amd64", info.Platform)
+}
+
+func TestGitHubSourceRequiresToken(t *testing.T) {
+	srv := newTestGitHub(t, []byte("new binary"), nil)
+	defer srv.Close()
+
+	s := &GitHubSource{Owner: "owner", Repo: "myapp", BaseURL: srv.URL + "/api/v3/"}
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64", ""); err == nil {
+		t.Error("expected an error without token")
+	}
+}
@@ -0,0 +1,246 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultGitLabURL = "https://gitlab.com/api/v4/"
+
+// GitLabSource is a Source reading releases of a GitLab project through the
+// GitLab REST API.
+//
+// The newest release of the project determines the version. Binaries are
+// looked up by the name produced by AssetName among the links of the
+// release or, if PackageName is set, in the generic package registry of the
+// project under the package version matching the release. Hashes are read
+// from the checksums file and signatures from files named like the binary
+// plus SignatureSuffix, just like for GitHubSource.
+//
+// Example:
+//
+//  updater := &selfupdate.Updater{
+//  	CurrentVersion: version,
+//  	CmdName:        "myapp",
+//  	Dir:            "update/",
+//  	Source: &selfupdate.GitLabSource{
+//  		BaseURL:     "https://gitlab.example.com/api/v4/",
+//  		Project:     "tools/myapp",
+//  		PackageName: "myapp",
+//  		Token:       os.Getenv("GITLAB_TOKEN"),
+//  	},
+//  }
+type GitLabSource struct {
+	Project         string         // ID or full path of the project, like tools/myapp.
+	BaseURL         string         // Optional API URL of a self-managed instance, e.g. https://gitlab.example.com/api/v4/. Defaults to https://gitlab.com/api/v4/
+	Token           string         // Optional project, group or personal access token
+	JobToken        string         // Optional CI job token, used if Token is empty
+	PackageName     string         // Optional generic package to download binaries from instead of release links
+	AssetName       string         // Optional template for the asset name. Defaults to "{{.CmdName}}_{{.Version}}_{{.OS}}_{{.Arch}}{{.Variant}}{{.Ext}}"
+	ChecksumsName   string         // Optional name of the checksums file. Defaults to checksums.txt
+	SignatureSuffix string         // Optional suffix of signature files. Defaults to .sig
+	TagPrefix       string         // Optional prefix removed from tags to get the version. Defaults to v
+	Requester       *HTTPRequester // Optional requester to configure timeouts, proxies or TLS
+}
+
+type gitLabRelease struct {
+	TagName         string     `json:"tag_name"`
+	UpcomingRelease bool       `json:"upcoming_release"`
+	Description     string     `json:"description"`
+	ReleasedAt      *time.Time `json:"released_at"`
+	Links           struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+	Assets struct {
+		Links []gitLabLink `json:"links"`
+	} `json:"assets"`
+}
+
+type gitLabLink struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+func (s *GitLabSource) String() string {
+	return s.projectURL()
+}
+
+// FetchInfo returns the newest release without prerelease suffix. If channel
+// is set, prereleases tagged with the channel name, like v1.3.0-beta.1 for
+// channel beta, are considered as well.
+func (s *GitLabSource) FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error) {
+	var releases []*gitLabRelease
+	if err := s.getJSON(ctx, s.projectURL()+"/releases?order_by=released_at&sort=desc", &releases); err != nil {
+		return Info{}, err
+	}
+	var release *gitLabRelease
+	for _, r := range releases {
+		if r.UpcomingRelease {
+			continue
+		}
+		if !strings.Contains(r.TagName, "-") || (channel != "" && strings.Contains(r.TagName, "-"+channel)) {
+			release = r
+			break
+		}
+	}
+	if release == nil {
+		return Info{}, nil
+	}
+
+	version := strings.TrimPrefix(release.TagName, s.tagPrefix())
+	name, err := assetName(s.AssetName, cmdName, version, platform)
+	if err != nil {
+		return Info{}, err
+	}
+	r, err := s.openFile(ctx, release, version, s.checksumsName())
+	if err != nil {
+		return Info{}, err
+	}
+	defer r.Close()
+	sha, err := findChecksum(r, name)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := Info{
+		Version:      version,
+		Sha256:       sha,
+		ReleaseDate:  release.ReleasedAt,
+		ReleaseNotes: release.Description,
+		NotesURL:     release.Links.Self,
+	}
+	sig, err := s.openFile(ctx, release, version, name+s.signatureSuffix())
+	if err == nil {
+		defer sig.Close()
+		if info.Signature, err = readSignature(sig); err != nil {
+			return Info{}, err
+		}
+	} else if !isNotFound(err) {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// FetchPatch always returns ErrNoPatch since GitLab releases carry no patches.
+func (s *GitLabSource) FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error) {
+	return nil, ErrNoPatch
+}
+
+// FetchBin downloads the binary of the release tagged with version. A file
+// with an additional ".gz" extension is decompressed.
+func (s *GitLabSource) FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error) {
+	var release *gitLabRelease
+	if s.PackageName == "" {
+		release = &gitLabRelease{}
+		if err := s.getJSON(ctx, s.projectURL()+"/releases/"+url.PathEscape(s.tagPrefix()+version), release); err != nil {
+			return nil, err
+		}
+	}
+	name, err := assetName(s.AssetName, cmdName, version, platform)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.openFile(ctx, release, version, name)
+	if isNotFound(err) {
+		if r, err = s.openFile(ctx, release, version, name+".gz"); err == nil {
+			return gunzip(r)
+		}
+	}
+	return r, err
+}
+
+// openFile opens the file name of a release, either from the package
+// registry or from the release links. A missing file results in a 404
+// StatusError.
+func (s *GitLabSource) openFile(ctx context.Context, release *gitLabRelease, version, name string) (io.ReadCloser, error) {
+	u := ""
+	if s.PackageName != "" {
+		u = s.projectURL() + "/packages/generic/" + url.PathEscape(s.PackageName) + "/" + url.PathEscape(version) + "/" + url.PathEscape(name)
+	} else {
+		for _, link := range release.Assets.Links {
+			if link.Name != name {
+				continue
+			}
+			u = link.DirectAssetURL
+			if u == "" {
+				u = link.URL
+			}
+		}
+		if u == "" {
+			return nil, &StatusError{URL: name, StatusCode: http.StatusNotFound, Status: fmt.Sprintf("release %s has no asset %s", release.TagName, name)}
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GitLabSource) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	r, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// do sends req, authenticating it if it is sent to the GitLab instance.
+// Release links may point to other hosts which must not see the token.
+func (s *GitLabSource) do(req *http.Request) (io.ReadCloser, error) {
+	if base, err := url.Parse(s.baseURL()); err == nil && base.Host == req.URL.Host {
+		if s.Token != "" {
+			req.Header.Set("PRIVATE-TOKEN", s.Token)
+		} else if s.JobToken != "" {
+			req.Header.Set("JOB-TOKEN", s.JobToken)
+		}
+	}
+	if s.Requester == nil {
+		return (&HTTPRequester{}).do(req)
+	}
+	return s.Requester.do(req)
+}
+
+func (s *GitLabSource) projectURL() string {
+	return s.baseURL() + "projects/" + url.PathEscape(s.Project)
+}
+
+func (s *GitLabSource) baseURL() string {
+	if s.BaseURL == "" {
+		return defaultGitLabURL
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/"
+}
+
+func (s *GitLabSource) tagPrefix() string {
+	if s.TagPrefix == "" {
+		return defaultTagPrefix
+	}
+	return s.TagPrefix
+}
+
+func (s *GitLabSource) checksumsName() string {
+	if s.ChecksumsName == "" {
+		return defaultChecksumsName
+	}
+	return s.ChecksumsName
+}
+
+func (s *GitLabSource) signatureSuffix() string {
+	if s.SignatureSuffix == "" {
+		return defaultSignatureSuffix
+	}
+	return s.SignatureSuffix
+}
@@ -0,0 +1,96 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestGitLab serves the releases and generic packages of tools/myapp like
+// the GitLab REST API. Only requests carrying the job token are accepted.
+func newTestGitLab(t *testing.T, bin []byte) *httptest.Server {
+	t.Helper()
+	name := "myapp_1.3.0_linux_amd64"
+	files := map[string][]byte{
+		name:            bin,
+		"checksums.txt": []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(bin), name)),
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("JOB-TOKEN") != "job-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		project := "/api/v4/projects/tools%2Fmyapp"
+		path := r.URL.EscapedPath()
+		release := gitLabRelease{TagName: "v1.3.0"}
+		for n := range files {
+			release.Assets.Links = append(release.Assets.Links, gitLabLink{Name: n, DirectAssetURL: srv.URL + project + "/packages/generic/myapp/1.3.0/" + n})
+		}
+		switch {
+		case path == project+"/releases":
+			json.NewEncoder(w).Encode([]gitLabRelease{{TagName: "v1.4.0-beta.1"}, {TagName: "v1.5.0", UpcomingRelease: true}, release})
+		case path == project+"/releases/v1.3.0":
+			json.NewEncoder(w).Encode(release)
+		case strings.HasPrefix(path, project+"/packages/generic/myapp/1.3.0/"):
+			b, ok := files[strings.TrimPrefix(path, project+"/packages/generic/myapp/1.3.0/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv
+}
+
+func TestGitLabSource(t *testing.T) {
+	bin := []byte("new binary")
+	srv := newTestGitLab(t, bin)
+	defer srv.Close()
+
+	for _, packageName := range []string{"", "myapp"} {
+		updater := &Updater{
+			CurrentVersion: "1.2.0",
+			CmdName:        "myapp",
+			Platform:       "linux-amd64",
+			Source:         &GitLabSource{BaseURL: srv.URL + "/api/v4/", Project: "tools/myapp", JobToken: "job-token", PackageName: packageName},
+		}
+		info, err := updater.GetNextVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		equals(t, "1.3.0", info.Version)
+		if info.Signature != nil {
+			t.Error("expected no signature")
+		}
+		got, err := updater.fetchAndVerifyFullBin(context.Background(), info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equals(t, string(bin), string(got))
+	}
+}
+
+func TestGitLabSourceChannelAndAuth(t *testing.T) {
+	srv := newTestGitLab(t, []byte("new binary"))
+	defer srv.Close()
+
+	s := &GitLabSource{BaseURL: srv.URL + "/api/v4", Project: "tools/myapp", Token: "wrong"}
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64", ""); err == nil {
+		t.Error("expected an error with a wrong token")
+	}
+
+	s = &GitLabSource{BaseURL: srv.URL + "/api/v4", Project: "tools/myapp", JobToken: "job-token"}
+	if _, err := s.FetchInfo(context.Background(), "myapp", "linux-amd64", "beta"); err == nil {
+		t.Error("expected an error for a beta release without assets")
+	}
+}
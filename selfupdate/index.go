@@ -0,0 +1,246 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	indexPath          = "index.json"
+	indexSignaturePath = "index.json.sig"
+)
+
+// ErrNoIndex is returned if the source of the manifests has no index.
+var ErrNoIndex = errors.New("no release index available")
+
+// Index lists every version of a command written by CreateUpdate to
+// index.json next to the manifests of the platforms.
+type Index struct {
+	Versions  []IndexVersion    // All versions, newest first.
+	Channels  map[string]string `json:",omitempty"` // Version each channel points at, see AssignChannel.
+	Signature []byte            `json:"-"`          // Signature of the SHA-256 hash of index.json, read from index.json.sig.
+}
+
+// IndexVersion lists the platforms of a version.
+type IndexVersion struct {
+	Version   string
+	Platforms map[string]Info // Manifests by platform, with hashes, sizes and patch sizes.
+}
+
+// IndexSource is implemented by sources that can read the index of a
+// command.
+type IndexSource interface {
+	Source
+	// FetchIndex returns the index.json of cmdName as published and the
+	// signature from index.json.sig, which is nil if there is none.
+	FetchIndex(ctx context.Context, cmdName string) (index, signature []byte, err error)
+}
+
+// Index reads the index of CmdName from ApiURL, its mirrors or Source. The
+// signature of the index is checked if PublicKey is set.
+func (u *Updater) Index() (Index, error) {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return Index{}, err
+	}
+	ctx := u.withDownload(context.Background(), DownloadManifest)
+	var index Index
+	err = u.tryMirrors(u.ApiURL, u.ApiMirrors, func(s Source) error {
+		indexed, ok := unwrapSource(s).(IndexSource)
+		if !ok {
+			return ErrNoIndex
+		}
+		index, err = u.fetchIndex(ctx, indexed)
+		return err
+	})
+	if err != nil {
+		return Index{}, err
+	}
+	return index, nil
+}
+
+// fetchIndex reads and verifies the index of s.
+func (u *Updater) fetchIndex(ctx context.Context, s IndexSource) (Index, error) {
+	b, sig, err := s.FetchIndex(ctx, u.CmdName)
+	if err != nil {
+		return Index{}, err
+	}
+	// the published bytes are verified, fields unknown to this version are
+	// lost once decoded
+	if !verifySignature(u.PublicKey, b, sig) {
+		u.recordSignatureFailure()
+		return Index{}, ErrSignatureMismatch
+	}
+	index, err := decodeIndex(bytes.NewReader(b))
+	if err != nil {
+		return Index{}, err
+	}
+	index.Signature = sig
+	return index, nil
+}
+
+// channelInfo returns the manifest of the version Channel points at in the
+// index of s. The manifests of the platforms don't know about channels.
+func (u *Updater) channelInfo(ctx context.Context, s IndexSource) (Info, error) {
+	index, err := u.fetchIndex(ctx, s)
+	if err != nil {
+		return Info{}, err
+	}
+	version, ok := index.Channels[u.Channel]
+	if !ok {
+		return Info{}, fmt.Errorf("channel %s not found", u.Channel)
+	}
+	return u.versionInfo(index, version)
+}
+
+// ListVersions returns the manifests of all versions available for the
+// platform, newest first. With Variants each version is listed with the
+// best variant for the machine.
+func (u *Updater) ListVersions() ([]Info, error) {
+	index, err := u.Index()
+	if err != nil {
+		return nil, err
+	}
+	var versions []Info
+	for _, v := range index.Versions {
+		if info, ok := u.indexInfo(v); ok {
+			versions = append(versions, info)
+		}
+	}
+	return versions, nil
+}
+
+// ResolveVersion returns the manifest of version, or of the version a
+// channel of the index points at, for the platform.
+func (u *Updater) ResolveVersion(version string) (Info, error) {
+	index, err := u.Index()
+	if err != nil {
+		return Info{}, err
+	}
+	if channelVersion, ok := index.Channels[version]; ok {
+		version = channelVersion
+	}
+	return u.versionInfo(index, version)
+}
+
+// versionInfo returns the manifest of version in index for the platform.
+func (u *Updater) versionInfo(index Index, version string) (Info, error) {
+	for _, v := range index.Versions {
+		if v.Version != version {
+			continue
+		}
+		if info, ok := u.indexInfo(v); ok {
+			return info, nil
+		}
+		return Info{}, fmt.Errorf("version %s is not available for %s", version, u.getPlatform())
+	}
+	return Info{}, fmt.Errorf("version %s not found", version)
+}
+
+// indexInfo returns the manifest of the best platform for the Updater.
+func (u *Updater) indexInfo(v IndexVersion) (Info, bool) {
+	for _, platform := range u.platforms() {
+		if info, ok := v.Platforms[platform]; ok {
+			info.Version, info.Platform = v.Version, platform
+			return info, true
+		}
+	}
+	return Info{}, false
+}
+
+func decodeIndex(r io.Reader) (Index, error) {
+	index := Index{}
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return Index{}, err
+	}
+	return index, nil
+}
+
+// AssignChannel points channel at version in the index of genDir, which
+// must list version. The index is signed with pk if it is set.
+func AssignChannel(genDir, channel, version string, pk *rsa.PrivateKey) error {
+	return updateIndex(genDir, pk, func(index *Index) error {
+		for _, v := range index.Versions {
+			if v.Version == version {
+				if index.Channels == nil {
+					index.Channels = map[string]string{}
+				}
+				index.Channels[channel] = version
+				return nil
+			}
+		}
+		return fmt.Errorf("version %s is not in the index of %s", version, genDir)
+	})
+}
+
+// indexPlatform adds the manifest info of platform to the index of genDir.
+func indexPlatform(genDir, platform string, info Info, pk *rsa.PrivateKey) error {
+	return updateIndex(genDir, pk, func(index *Index) error {
+		i := 0
+		for i < len(index.Versions) && index.Versions[i].Version != info.Version {
+			i++
+		}
+		if i == len(index.Versions) {
+			index.Versions = append(index.Versions, IndexVersion{Version: info.Version})
+		}
+		if index.Versions[i].Platforms == nil {
+			index.Versions[i].Platforms = map[string]Info{}
+		}
+		index.Versions[i].Platforms[platform] = info
+		sort.SliceStable(index.Versions, func(i, j int) bool {
+			return compareVersions(index.Versions[i].Version, index.Versions[j].Version) > 0
+		})
+		return nil
+	})
+}
+
+// updateIndex reads the index of genDir, changes it with fn and writes it
+// back, signed in index.json.sig if pk is set.
+func updateIndex(genDir string, pk *rsa.PrivateKey, fn func(*Index) error) error {
+	path := filepath.Join(genDir, indexPath)
+	index := Index{}
+	if f, err := os.Open(path); err == nil {
+		index, err = decodeIndex(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := fn(&index); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	sigPath := filepath.Join(genDir, indexSignaturePath)
+	if pk == nil {
+		if err := os.Remove(sigPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return ioutil.WriteFile(path, b, 0644)
+	}
+	hash := sha256.Sum256(b)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, hash[:])
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sigPath, sig, 0644)
+}
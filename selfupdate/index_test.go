@@ -0,0 +1,120 @@
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexListsAndResolvesVersions(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := newTestRelease(t, "myapp")
+	release.key = pk
+	release.publishVersions("linux-amd64", "1.2", "1.10", "1.3")
+	release.publishVersions("windows-amd64", "1.2", "1.10")
+	if err := AssignChannel(release.genDir, "stable", "1.3", pk); err != nil {
+		t.Fatal(err)
+	}
+	if err := AssignChannel(release.genDir, "beta", "2.0", pk); err == nil {
+		t.Error("expected an error assigning a channel to a missing version")
+	}
+
+	updater := release.updater("1.2", []byte("binary 1.2"))
+	updater.Platform = "windows-amd64"
+	index, err := updater.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 3, len(index.Versions))
+	equals(t, "1.10", index.Versions[0].Version)
+	equals(t, "1.3", index.Channels["stable"])
+	if index.Versions[0].Platforms["linux-amd64"].Size <= 0 {
+		t.Error("expected the index to list the size of 1.10")
+	}
+	if _, ok := index.Versions[0].Platforms["linux-amd64"].PatchSizes["1.2"]; !ok {
+		t.Error("expected the index to list the patch from 1.2 to 1.10")
+	}
+
+	versions, err := updater.ListVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, 2, len(versions))
+	equals(t, "1.10", versions[0].Version)
+	equals(t, "1.2", versions[1].Version)
+	equals(t, "windows-amd64", versions[1].Platform)
+
+	if _, err := updater.ResolveVersion("stable"); err == nil {
+		t.Error("expected 1.3 to be unavailable for windows")
+	}
+	updater.Platform = "linux-amd64"
+	info, err := updater.ResolveVersion("stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	equals(t, true, verifySignature(&pk.PublicKey, []byte("binary 1.3"), info.Signature))
+	if _, err := updater.ResolveVersion("0.9"); err == nil {
+		t.Error("expected an error resolving a missing version")
+	}
+
+	// the manifests of the platforms only have the latest version
+	updater.Channel = "stable"
+	if info, err = updater.GetNextVersion(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	equals(t, "linux-amd64", info.Platform)
+	updater.Channel = ""
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater.PublicKey = &other.PublicKey
+	if _, err := updater.Index(); err != ErrSignatureMismatch {
+		t.Errorf("expected ErrSignatureMismatch, got %v", err)
+	}
+}
+
+func TestIndexVerifiesPublishedBytes(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := newTestRelease(t, "myapp")
+	// published by a newer generator with a field this version doesn't know
+	b := []byte(`{"Versions": [{"Version": "1.3", "Platforms": {}}], "Released": "2026-01-01"}`)
+	hash := sha256.Sum256(b)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(release.genDir, "index.json"), b, 0644)
+	ioutil.WriteFile(filepath.Join(release.genDir, "index.json.sig"), sig, 0644)
+
+	updater := release.updater("1.2", []byte("binary 1.2"))
+	updater.PublicKey = &pk.PublicKey
+	index, err := updater.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", index.Versions[0].Version)
+
+	ioutil.WriteFile(filepath.Join(release.genDir, "index.json"), []byte(`{"Versions": [{"Version": "6.6", "Platforms": {}}], "Released": "2026-01-01"}`), 0644)
+	if _, err := updater.Index(); err != ErrSignatureMismatch {
+		t.Errorf("expected ErrSignatureMismatch, got %v", err)
+	}
+	os.Remove(filepath.Join(release.genDir, "index.json.sig"))
+	if _, err := updater.Index(); err != ErrSignatureMismatch {
+		t.Errorf("expected ErrSignatureMismatch without index.json.sig, got %v", err)
+	}
+}
@@ -1,7 +1,23 @@
 package selfupdate
 
+import "time"
+
+// Info is the manifest of a version. Everything but Version, Sha256 and
+// Signature is optional. Mandatory and MinimumVersion force clients to
+// update, the rest is metadata shown to users, e.g. as "What's new".
 type Info struct {
 	Version   string
 	Sha256    []byte
 	Signature []byte
+
+	Mandatory      bool              `json:",omitempty"` // Every client must install the update.
+	MinimumVersion string            `json:",omitempty"` // Versions older than this must install the update.
+	ReleaseDate    *time.Time        `json:",omitempty"` // Time the version was released.
+	ReleaseNotes   string            `json:",omitempty"` // Notes of the release in markdown.
+	NotesURL       string            `json:",omitempty"` // URL of the full release notes.
+	Size           int64             `json:",omitempty"` // Download size of the full binary.
+	PatchSizes     map[string]int64  `json:",omitempty"` // Download sizes of the patches by the version they apply to.
+	MinOSVersion   string            `json:",omitempty"` // Oldest supported version of the operating system.
+	Labels         map[string]string `json:",omitempty"` // Any other metadata.
+	Platform       string            `json:",omitempty"` // Platform the version was published for, like linux-amd64-v3.
 }
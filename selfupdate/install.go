@@ -0,0 +1,146 @@
+package selfupdate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// InstallError is returned if a new binary could not be installed. Unless
+// Partial is set the target still is the previous binary, or the new binary
+// if only the final sync failed.
+type InstallError struct {
+	Target  string // File that was replaced.
+	Op      string // Step that failed: stat, write, smoke test, backup, rename or sync.
+	Err     error  // Error of the step.
+	Partial bool   // The target is missing and the previous binary is only left at Backup.
+	Backup  string // Copy of the previous binary, if one was made.
+}
+
+func (e *InstallError) Error() string {
+	msg := fmt.Sprintf("update: installing %s failed to %s: %v", e.Target, e.Op, e.Err)
+	switch {
+	case e.Partial:
+		msg += "; the previous version is left at " + e.Backup
+	case e.Op == "sync":
+		msg += "; the new version is in place but may not survive a crash"
+	}
+	return msg
+}
+
+func (e *InstallError) Unwrap() error {
+	return e.Err
+}
+
+// installFile atomically replaces target by bin.
+//
+// The new file is written next to target with the same mode and owner and
+// synced to disk. If check is set, it is called with the path of the new
+// file and must succeed before anything else is done. The previous binary
+// is kept as .<name>.old, then the new file is renamed over target and the
+// directory is synced. Windows can't replace a running executable, so the
+// previous binary is moved away instead and moved back if the rename fails.
+func installFile(target string, bin []byte, check func(path string) error) error {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return &InstallError{Target: target, Op: "stat", Err: err}
+	}
+	dir, name := filepath.Split(target)
+	newPath := filepath.Join(dir, "."+name+".new")
+	oldPath := filepath.Join(dir, "."+name+".old")
+
+	if err := writeFileLike(newPath, bin, fi); err != nil {
+		_ = os.Remove(newPath)
+		return &InstallError{Target: target, Op: "write", Err: err}
+	}
+	if check != nil {
+		if err := check(newPath); err != nil {
+			_ = os.Remove(newPath)
+			return &InstallError{Target: target, Op: "smoke test", Err: err}
+		}
+	}
+
+	_ = os.Remove(oldPath)
+	if runtime.GOOS == "windows" {
+		err = os.Rename(target, oldPath)
+	} else {
+		err = linkOrCopy(target, oldPath, fi)
+	}
+	if err != nil {
+		_ = os.Remove(newPath)
+		return &InstallError{Target: target, Op: "backup", Err: err}
+	}
+
+	if err := os.Rename(newPath, target); err != nil {
+		_ = os.Remove(newPath)
+		e := &InstallError{Target: target, Op: "rename", Err: err, Backup: oldPath}
+		if _, statErr := os.Stat(target); os.IsNotExist(statErr) {
+			e.Partial = os.Rename(oldPath, target) != nil
+		}
+		return e
+	}
+	if err := syncDir(dir); err != nil {
+		return &InstallError{Target: target, Op: "sync", Err: err, Backup: oldPath}
+	}
+	return nil
+}
+
+// canInstall checks whether a new file can be created next to target.
+func canInstall(target string) error {
+	dir, name := filepath.Split(target)
+	path := filepath.Join(dir, "."+name+".new")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(path)
+}
+
+// writeFileLike writes data to path with the mode and owner of fi and syncs
+// it to disk.
+func writeFileLike(path string, data []byte, fi os.FileInfo) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	// changing the owner clears setuid bits, so it goes first
+	if err := chownLike(f, fi); err != nil {
+		return err
+	}
+	if err := f.Chmod(fi.Mode()); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// linkOrCopy makes dst a hard link of src, or a copy on file systems
+// without hard links.
+func linkOrCopy(src, dst string, fi os.FileInfo) error {
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
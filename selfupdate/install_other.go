@@ -0,0 +1,16 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package selfupdate
+
+import "os"
+
+// chownLike does nothing since files have no unix owner on this system.
+func chownLike(f *os.File, fi os.FileInfo) error {
+	return nil
+}
+
+// syncDir does nothing since directories can't be synced on this system.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package selfupdate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestInstallFileKeepsModeAndBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "myapp")
+	ioutil.WriteFile(target, []byte("old binary"), 0750)
+	os.Chmod(target, 0750)
+
+	if err := installFile(target, []byte("new binary"), nil); err != nil {
+		t.Fatal(err)
+	}
+	bin, _ := ioutil.ReadFile(target)
+	equals(t, "new binary", string(bin))
+	old, _ := ioutil.ReadFile(filepath.Join(dir, ".myapp.old"))
+	equals(t, "old binary", string(old))
+	if _, err := os.Stat(filepath.Join(dir, ".myapp.new")); !os.IsNotExist(err) {
+		t.Errorf("expected the new file to be renamed, got %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		fi, _ := os.Stat(target)
+		equals(t, os.FileMode(0750), fi.Mode())
+	}
+
+	// the previous backup is replaced
+	if err := installFile(target, []byte("newer binary"), nil); err != nil {
+		t.Fatal(err)
+	}
+	old, _ = ioutil.ReadFile(filepath.Join(dir, ".myapp.old"))
+	equals(t, "new binary", string(old))
+}
+
+func TestInstallFileReportsStep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = installFile(filepath.Join(dir, "missing"), []byte("new binary"), nil)
+	var installErr *InstallError
+	if !errors.As(err, &installErr) {
+		t.Fatalf("expected an InstallError, got %v", err)
+	}
+	equals(t, "stat", installErr.Op)
+	equals(t, false, installErr.Partial)
+	if !os.IsNotExist(installErr.Err) {
+		t.Errorf("expected a not exist error, got %v", installErr.Err)
+	}
+
+	// a directory in place of the new file makes writing it fail
+	target := filepath.Join(dir, "myapp")
+	ioutil.WriteFile(target, []byte("old binary"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".myapp.new", "x"), 0755)
+	if err := installFile(target, []byte("new binary"), nil); !errors.As(err, &installErr) || installErr.Op != "write" {
+		t.Errorf("expected a write InstallError, got %v", err)
+	}
+	bin, _ := ioutil.ReadFile(target)
+	equals(t, "old binary", string(bin))
+}
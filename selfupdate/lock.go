@@ -0,0 +1,89 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	lockPath         = "lock"
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// ErrLockTimeout is returned if the update lock could not be acquired
+// within LockTimeout.
+var ErrLockTimeout = errors.New("update: timed out waiting for another process to finish updating")
+
+// errLocked is returned by tryLockFile if another process holds the lock.
+var errLocked = errors.New("locked")
+
+// LockMode controls what happens if another process using the same Dir is
+// already checking for or applying an update.
+type LockMode int
+
+const (
+	// LockSkip skips the update, it is left to the other process.
+	LockSkip LockMode = iota
+	// LockWait waits until the other process is done, at most LockTimeout
+	// if it is set.
+	LockWait
+	// LockDisabled doesn't lock at all.
+	LockDisabled
+)
+
+// lock acquires the advisory lock in the state directory held for a whole
+// check, download and apply cycle. The returned release function must be
+// called to give it up. ok is false if the update should be skipped.
+//
+// The lock is held by the operating system, so it is released if a process
+// crashes. On systems without file locking a lock older than an hour is
+// considered left behind by a crashed process and broken.
+func (u *Updater) lock() (release func(), ok bool, err error) {
+	if u.LockMode == LockDisabled {
+		return func() {}, true, nil
+	}
+	dir := u.getExecRelativeDir(u.Dir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, false, err
+	}
+	f, err := os.OpenFile(u.getExecRelativeDir(u.Dir+lockPath), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var deadline time.Time
+	if u.LockTimeout > 0 {
+		deadline = time.Now().Add(u.LockTimeout)
+	}
+	for {
+		err = tryLockFile(f)
+		if err != errLocked {
+			break
+		}
+		if u.LockMode == LockSkip {
+			f.Close()
+			log.Println("update: skipped, another process is updating")
+			return nil, false, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			f.Close()
+			return nil, false, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+
+	// record the owner to ease debugging of hanging updates
+	_ = f.Truncate(0)
+	_, _ = f.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), time.Now().Format(time.RFC3339))), 0)
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, true, nil
+}
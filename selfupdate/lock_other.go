@@ -0,0 +1,38 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package selfupdate
+
+import (
+	"os"
+	"time"
+)
+
+// staleLockAge is the age after which a lock is considered left behind by a
+// crashed process.
+const staleLockAge = time.Hour
+
+// tryLockFile creates a sibling file exclusively since there is no file
+// locking on this system.
+func tryLockFile(f *os.File) error {
+	path := f.Name() + ".held"
+	for i := 0; i < 2; i++ {
+		held, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return held.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		fi, err := os.Stat(path)
+		if err != nil || time.Since(fi.ModTime()) < staleLockAge {
+			return errLocked
+		}
+		_ = os.Remove(path)
+	}
+	return errLocked
+}
+
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + ".held")
+}
@@ -0,0 +1,179 @@
+package selfupdate
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"sync"
+)
+
+// Results of updates counted by Metrics.
+const (
+	ResultUpdated  = "updated"   // A new version was installed.
+	ResultStaged   = "staged"    // A new version was staged, see DeferApply.
+	ResultDryRun   = "dry_run"   // A new version was verified but not installed, see DryRun.
+	ResultNoUpdate = "no_update" // No update was available, or it was skipped or deferred.
+	ResultAborted  = "aborted"   // A consent callback aborted the update.
+	ResultFailed   = "failed"    // The update failed.
+)
+
+// Kinds of downloads counted by Metrics.
+const (
+	DownloadManifest = "manifest" // Manifests and indexes.
+	DownloadPatch    = "patch"
+	DownloadFull     = "full"
+)
+
+// Metrics collects the update activity of the Updaters it is set on. It is
+// published with expvar by Publish, the prometheus subpackage exports it to
+// Prometheus.
+//
+// Downloaded bytes are counted for the URL layout and for sources using an
+// HTTPRequester, like GitHubSource or OCIRegistry. Files read by an FSSource
+// aren't downloads.
+type Metrics struct {
+	mu       sync.Mutex
+	snapshot MetricsSnapshot
+}
+
+// MetricsSnapshot is the state of Metrics at one point in time.
+type MetricsSnapshot struct {
+	Checks            int64            // Manifests fetched.
+	Results           map[string]int64 // Updates by result like ResultUpdated.
+	DownloadedBytes   map[string]int64 // Bytes downloaded by kind like DownloadPatch.
+	PatchFallbacks    int64            // Patches failing the hash check, replaced by the full binary.
+	SignatureFailures int64            // Binaries or indexes with a bad signature.
+	InstalledVersion  string           // Version installed last, or CurrentVersion of the first check.
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Snapshot returns a copy of the current metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.snapshot
+	s.Results = copyCounts(m.snapshot.Results)
+	s.DownloadedBytes = copyCounts(m.snapshot.DownloadedBytes)
+	return s
+}
+
+// Publish publishes the metrics as expvar variable name, which must be
+// unique.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(counts))
+	for k, v := range counts {
+		c[k] = v
+	}
+	return c
+}
+
+// update changes the metrics with fn. Metrics may be nil.
+func (m *Metrics) update(fn func(s *MetricsSnapshot)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshot.Results == nil {
+		m.snapshot.Results, m.snapshot.DownloadedBytes = map[string]int64{}, map[string]int64{}
+	}
+	fn(&m.snapshot)
+}
+
+// recordCheck counts a manifest fetched by u.
+func (u *Updater) recordCheck() {
+	u.Metrics.update(func(s *MetricsSnapshot) {
+		s.Checks++
+		if s.InstalledVersion == "" {
+			s.InstalledVersion = u.CurrentVersion
+		}
+	})
+}
+
+// resultOf returns the result of an update returning info and err.
+func resultOf(info Info, err error, dryRun, deferApply bool) string {
+	switch {
+	case err == ErrAborted:
+		return ResultAborted
+	case err != nil:
+		return ResultFailed
+	case info.Version == "":
+		return ResultNoUpdate
+	case dryRun:
+		return ResultDryRun
+	case deferApply:
+		return ResultStaged
+	}
+	return ResultUpdated
+}
+
+// recordResult counts the result of an update to info.
+func (u *Updater) recordResult(result string, info Info) {
+	u.Metrics.update(func(s *MetricsSnapshot) {
+		s.Results[result]++
+		if result == ResultUpdated {
+			s.InstalledVersion = info.Version
+		}
+	})
+}
+
+func (u *Updater) recordPatchFallback() {
+	u.Metrics.update(func(s *MetricsSnapshot) { s.PatchFallbacks++ })
+}
+
+func (u *Updater) recordSignatureFailure() {
+	u.Metrics.update(func(s *MetricsSnapshot) { s.SignatureFailures++ })
+}
+
+type downloadKey struct{}
+
+// download is the kind of download requested with a context, and the
+// metrics counting it.
+type download struct {
+	metrics *Metrics
+	kind    string
+}
+
+// withDownload returns a context counting the bytes downloaded with it as
+// kind.
+func (u *Updater) withDownload(ctx context.Context, kind string) context.Context {
+	if u.Metrics == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, downloadKey{}, download{u.Metrics, kind})
+}
+
+// countDownload returns r counting the bytes read from it if ctx was created
+// by withDownload.
+func countDownload(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	d, ok := ctx.Value(downloadKey{}).(download)
+	if _, counted := r.(*countingReader); !ok || counted || r == nil {
+		return r
+	}
+	return &countingReader{ReadCloser: r, count: func(n int) {
+		d.metrics.update(func(s *MetricsSnapshot) { s.DownloadedBytes[d.kind] += int64(n) })
+	}}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count func(n int)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.count(n)
+	}
+	return n, err
+}
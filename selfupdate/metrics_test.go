@@ -0,0 +1,63 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdaterMetrics(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := newTestRelease(t, "myapp")
+	release.key = pk
+	oldBin := bytes.Repeat([]byte("old binary "), 100)
+	release.publish(Info{Version: "1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3"}, "linux-amd64", []byte("new binary"))
+	patch := release.breakPatch("1.2", "1.3", "linux-amd64", oldBin)
+
+	metrics := NewMetrics()
+	updater := release.updater("1.2", oldBin)
+	updater.Metrics = metrics
+	release.serve(updater, release.files())
+	target := updater.Target
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	s := metrics.Snapshot()
+	equals(t, int64(1), s.Checks)
+	equals(t, int64(1), s.Results[ResultUpdated])
+	equals(t, int64(1), s.PatchFallbacks)
+	equals(t, "1.3", s.InstalledVersion)
+	manifest, _ := ioutil.ReadFile(filepath.Join(release.genDir, "linux-amd64.json"))
+	equals(t, int64(len(manifest)), s.DownloadedBytes[DownloadManifest])
+	equals(t, int64(len(patch)), s.DownloadedBytes[DownloadPatch])
+	full, _ := os.Stat(filepath.Join(release.genDir, "1.3", "linux-amd64.gz"))
+	equals(t, full.Size(), s.DownloadedBytes[DownloadFull])
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(target, oldBin, 0755)
+	updater.PublicKey = &other.PublicKey
+	if _, err := updater.Update(); err == nil {
+		t.Error("expected the update to fail with another key")
+	}
+	s = metrics.Snapshot()
+	equals(t, int64(1), s.Results[ResultFailed])
+	equals(t, int64(1), s.SignatureFailures)
+
+	metrics.Publish("selfupdate_test")
+	if v := expvar.Get("selfupdate_test"); v == nil || !strings.Contains(v.String(), `"PatchFallbacks":2`) {
+		t.Errorf("expected the metrics to be published, got %v", v)
+	}
+}
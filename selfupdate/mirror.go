@@ -0,0 +1,156 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	mirrorsPath    = "mirrors.json"
+	mirrorCooldown = time.Hour
+)
+
+// Mirror is an additional base URL serving the same files as ApiURL, BinURL
+// or DiffURL.
+//
+// Mirrors are tried after the primary URL in the listed order. If any
+// mirror has a Weight, mirrors are instead shuffled randomly with a chance
+// proportional to their weight, mirrors without weight are tried last.
+// URLs that failed within the last hour are tried after all others.
+//
+// Binaries and patches from any mirror must match the hash and signature of
+// the manifest read from ApiURL or one of ApiMirrors, so only these URLs
+// need to be trusted.
+type Mirror struct {
+	URL    string // Base URL like ApiURL.
+	Weight int    // Optional weight for random ordering
+}
+
+// MirrorStatus is the health of a URL stored in the mirrors state file.
+type MirrorStatus struct {
+	Failures    int       // Number of failures since the last success.
+	LastFailure time.Time // Time of the last failure.
+}
+
+// mirrorSource is a source to try for a resource, along with the URL it is
+// reading from if it is one of the configured URLs.
+type mirrorSource struct {
+	Source
+	url string
+}
+
+// getSources returns the sources to try in order for a resource with the
+// given primary URL and mirrors. A configured Source is the only one tried.
+func (u *Updater) getSources(primary string, mirrors []Mirror) []mirrorSource {
+	if u.Source != nil {
+		return []mirrorSource{{Source: u.Source}}
+	}
+	var sources []mirrorSource
+	for _, base := range u.orderMirrors(primary, mirrors) {
+		sources = append(sources, mirrorSource{Source: &urlSource{u: u, base: base}, url: base})
+	}
+	return sources
+}
+
+// tryMirrors calls fn for the sources of a resource until it succeeds and
+// records the health of the URLs tried. The last error is returned if all
+// sources fail.
+func (u *Updater) tryMirrors(primary string, mirrors []Mirror, fn func(Source) error) error {
+	var err error
+	for _, s := range u.getSources(primary, mirrors) {
+		err = fn(s)
+		if s.url != "" && len(mirrors) > 0 && err != ErrNoPatch {
+			u.recordMirror(s.url, err == nil)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// orderMirrors returns the URLs of a resource in the order they should be
+// tried.
+func (u *Updater) orderMirrors(primary string, mirrors []Mirror) []string {
+	urls := []string{primary}
+	if primary == "" && len(mirrors) > 0 {
+		urls = nil
+	}
+
+	weighted := false
+	for _, m := range mirrors {
+		weighted = weighted || m.Weight > 0
+	}
+	remaining := append([]Mirror(nil), mirrors...)
+	for weighted && len(remaining) > 0 {
+		total := 0
+		for _, m := range remaining {
+			total += m.Weight
+		}
+		if total == 0 {
+			break
+		}
+		n := rand.Intn(total)
+		for i, m := range remaining {
+			if n -= m.Weight; n < 0 {
+				urls = append(urls, m.URL)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, m := range remaining {
+		urls = append(urls, m.URL)
+	}
+
+	if len(mirrors) == 0 {
+		return urls
+	}
+	health := u.readMirrorHealth()
+	sort.SliceStable(urls, func(i, j int) bool {
+		return isHealthy(health[urls[i]]) && !isHealthy(health[urls[j]])
+	})
+	return urls
+}
+
+// MirrorHealth returns the status of every URL that failed since its last
+// success.
+func (u *Updater) MirrorHealth() map[string]MirrorStatus {
+	return u.readMirrorHealth()
+}
+
+func isHealthy(h MirrorStatus) bool {
+	return h.Failures == 0 || time.Since(h.LastFailure) > mirrorCooldown
+}
+
+func (u *Updater) recordMirror(url string, ok bool) {
+	health := u.readMirrorHealth()
+	if ok {
+		if _, failed := health[url]; !failed {
+			return
+		}
+		delete(health, url)
+	} else {
+		h := health[url]
+		h.Failures++
+		h.LastFailure = time.Now()
+		health[url] = h
+	}
+	b, err := json.Marshal(health)
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(u.getExecRelativeDir(u.Dir+mirrorsPath), b, 0644)
+}
+
+func (u *Updater) readMirrorHealth() map[string]MirrorStatus {
+	health := map[string]MirrorStatus{}
+	b, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + mirrorsPath))
+	if err == nil {
+		_ = json.Unmarshal(b, &health)
+	}
+	return health
+}
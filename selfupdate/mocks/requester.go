@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	io "io"
 	reflect "reflect"
@@ -47,3 +48,56 @@ func (mr *MockRequesterMockRecorder) Fetch(url interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockRequester)(nil).Fetch), url)
 }
+
+// MockContextRequester is a mock of ContextRequester interface
+type MockContextRequester struct {
+	ctrl     *gomock.Controller
+	recorder *MockContextRequesterMockRecorder
+}
+
+// MockContextRequesterMockRecorder is the mock recorder for MockContextRequester
+type MockContextRequesterMockRecorder struct {
+	mock *MockContextRequester
+}
+
+// NewMockContextRequester creates a new mock instance
+func NewMockContextRequester(ctrl *gomock.Controller) *MockContextRequester {
+	mock := &MockContextRequester{ctrl: ctrl}
+	mock.recorder = &MockContextRequesterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockContextRequester) EXPECT() *MockContextRequesterMockRecorder {
+	return m.recorder
+}
+
+// Fetch mocks base method
+func (m *MockContextRequester) Fetch(url string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", url)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch
+func (mr *MockContextRequesterMockRecorder) Fetch(url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockContextRequester)(nil).Fetch), url)
+}
+
+// FetchContext mocks base method
+func (m *MockContextRequester) FetchContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchContext", ctx, url)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchContext indicates an expected call of FetchContext
+func (mr *MockContextRequesterMockRecorder) FetchContext(ctx, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchContext", reflect.TypeOf((*MockContextRequester)(nil).FetchContext), ctx, url)
+}
@@ -0,0 +1,495 @@
+package selfupdate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+	ociBinaryMediaType   = "application/vnd.go-selfupdate.binary.v1+gzip"
+	ociArtifactType      = "application/vnd.go-selfupdate.release.v1"
+
+	ociVersionAnnotation   = "org.opencontainers.image.version"
+	ociTitleAnnotation     = "org.opencontainers.image.title"
+	ociPlatformAnnotation  = "com.github.silthus.go-selfupdate.platform"
+	ociSha256Annotation    = "com.github.silthus.go-selfupdate.sha256"
+	ociSignatureAnnotation = "com.github.silthus.go-selfupdate.signature"
+	ociInfoAnnotation      = "com.github.silthus.go-selfupdate.info"
+
+	defaultOCITag = "latest"
+)
+
+var ociEmptyConfig = []byte("{}")
+
+// OCIRegistry publishes and fetches updates as OCI artifacts through the
+// OCI Distribution API. It is a Source for the Updater.
+//
+// Every version is an image index tagged with the version. The index holds
+// one artifact manifest per platform whose single layer is the gzipped
+// binary. Hash, signature and metadata of the binary are stored as
+// annotations of the manifest. Channels are additional tags pointing at the
+// index of the newest version on the channel, "latest" is used if no
+// channel is configured.
+//
+// Registries requiring token authentication are supported, Username and
+// Password are used to obtain tokens or for basic authentication.
+//
+// Example:
+//
+//  registry, err := selfupdate.NewOCIRegistry("registry.example.com/tools/myapp")
+//  if err != nil {
+//  	log.Fatal(err)
+//  }
+//  updater := &selfupdate.Updater{
+//  	CurrentVersion: version,
+//  	Dir:            "update/",
+//  	CmdName:        "myapp",
+//  	Source:         registry,
+//  }
+type OCIRegistry struct {
+	Registry   string         // Base URL of the registry like https://registry.example.com.
+	Repository string         // Name of the repository like tools/myapp.
+	Username   string         // Optional user name for token or basic authentication
+	Password   string         // Optional password or identity token
+	Requester  *HTTPRequester // Optional requester to configure timeouts, proxies or TLS
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer token by scope
+}
+
+// NewOCIRegistry returns a registry for a reference like
+// registry.example.com/tools/myapp. HTTPS is used unless the reference
+// starts with http://.
+func NewOCIRegistry(ref string) (*OCIRegistry, error) {
+	scheme := "https://"
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		i := strings.Index(ref, "://") + 3
+		scheme, ref = ref[:i], ref[i:]
+	}
+	i := strings.Index(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return nil, fmt.Errorf("invalid OCI reference %s, expected registry/repository", ref)
+	}
+	return &OCIRegistry{Registry: scheme + ref[:i], Repository: strings.TrimSuffix(ref[i+1:], "/")}, nil
+}
+
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Platform     *ociPlatform      `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *ociDescriptor    `json:"config,omitempty"`
+	Layers        []ociDescriptor   `json:"layers,omitempty"`
+	Manifests     []ociDescriptor   `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+func (r *OCIRegistry) String() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// FetchInfo reads the manifest of platform from the index tagged with
+// channel, or latest if channel is empty.
+func (r *OCIRegistry) FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error) {
+	tag := channel
+	if tag == "" {
+		tag = defaultOCITag
+	}
+	m, err := r.platformManifest(ctx, tag, platform)
+	if err != nil || m == nil {
+		if isNotFound(err) {
+			return Info{}, nil
+		}
+		return Info{}, err
+	}
+	info := Info{}
+	if metadata := m.Annotations[ociInfoAnnotation]; metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &info); err != nil {
+			return Info{}, err
+		}
+	}
+	info.Version = m.Annotations[ociVersionAnnotation]
+	if len(m.Layers) == 1 {
+		info.Size = m.Layers[0].Size
+	}
+	if info.Sha256, err = base64.StdEncoding.DecodeString(m.Annotations[ociSha256Annotation]); err != nil {
+		return Info{}, err
+	}
+	if sig := m.Annotations[ociSignatureAnnotation]; sig != "" {
+		if info.Signature, err = base64.StdEncoding.DecodeString(sig); err != nil {
+			return Info{}, err
+		}
+	}
+	return info, nil
+}
+
+// FetchPatch always returns ErrNoPatch since only full binaries are published.
+func (r *OCIRegistry) FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error) {
+	return nil, ErrNoPatch
+}
+
+// FetchBin downloads the binary layer of platform from the index tagged with
+// version.
+func (r *OCIRegistry) FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error) {
+	m, err := r.platformManifest(ctx, version, platform)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || len(m.Layers) != 1 || m.Layers[0].MediaType != ociBinaryMediaType {
+		return nil, fmt.Errorf("no binary for %s in %s:%s", platform, r, version)
+	}
+	resp, err := r.request(ctx, http.MethodGet, "blobs/"+m.Layers[0].Digest, "pull", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gunzip(resp.Body)
+}
+
+// Push publishes the binary at path as version for platform and points the
+// given tags, e.g. channel names, at the version. The binary is signed with
+// pk if given.
+func (r *OCIRegistry) Push(ctx context.Context, version Info, path, platform string, pk *rsa.PrivateKey, tags ...string) error {
+	bin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sha := sha256.Sum256(bin)
+	annotations := map[string]string{
+		ociVersionAnnotation:  version.Version,
+		ociPlatformAnnotation: platform,
+		ociSha256Annotation:   base64.StdEncoding.EncodeToString(sha[:]),
+	}
+	if pk != nil {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, sha[:])
+		if err != nil {
+			return err
+		}
+		annotations[ociSignatureAnnotation] = base64.StdEncoding.EncodeToString(sig)
+	}
+	metadata := version
+	metadata.Version, metadata.Sha256, metadata.Signature = "", nil, nil
+	metadata.Size, metadata.PatchSizes = 0, nil
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	annotations[ociInfoAnnotation] = string(b)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(bin)
+	w.Close()
+	layer, err := r.pushBlob(ctx, ociBinaryMediaType, gz.Bytes())
+	if err != nil {
+		return err
+	}
+	layer.Annotations = map[string]string{ociTitleAnnotation: platform + ".gz"}
+	config, err := r.pushBlob(ctx, ociEmptyMediaType, ociEmptyConfig)
+	if err != nil {
+		return err
+	}
+	manifest, err := r.pushManifest(ctx, "", &ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  ociArtifactType,
+		Config:        &config,
+		Layers:        []ociDescriptor{layer},
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return err
+	}
+	manifest.ArtifactType = ociArtifactType
+	manifest.Annotations = map[string]string{ociPlatformAnnotation: platform}
+	if goos, goarch := splitPlatform(platform); goarch != "" {
+		manifest.Platform = &ociPlatform{OS: goos, Architecture: goarch}
+		// OCI only knows CPU variants like v7, a libc stays in the annotation
+		if _, variant := splitVariant(platform); strings.HasPrefix(variant, "v") {
+			manifest.Platform.Variant = strings.SplitN(variant, "-", 2)[0]
+		}
+	}
+
+	index, err := r.index(ctx, version.Version)
+	if isNotFound(err) {
+		index, err = &ociManifest{SchemaVersion: 2, MediaType: ociIndexMediaType, ArtifactType: ociArtifactType}, nil
+	}
+	if err != nil {
+		return err
+	}
+	manifests := []ociDescriptor{manifest}
+	for _, m := range index.Manifests {
+		if m.Annotations[ociPlatformAnnotation] != platform {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = manifests
+	index.Annotations = map[string]string{ociVersionAnnotation: version.Version}
+	for _, tag := range append([]string{version.Version}, tags...) {
+		if _, err := r.pushManifest(ctx, tag, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// platformManifest returns the manifest of platform in the index tagged with
+// tag, or nil if the index has no manifest for platform.
+func (r *OCIRegistry) platformManifest(ctx context.Context, tag, platform string) (*ociManifest, error) {
+	index, err := r.index(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range index.Manifests {
+		if d.Annotations[ociPlatformAnnotation] != platform {
+			continue
+		}
+		m := &ociManifest{}
+		if err := r.getManifest(ctx, d.Digest, ociManifestMediaType, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+func (r *OCIRegistry) index(ctx context.Context, tag string) (*ociManifest, error) {
+	index := &ociManifest{}
+	if err := r.getManifest(ctx, tag, ociIndexMediaType, index); err != nil {
+		return nil, err
+	}
+	if index.MediaType != ociIndexMediaType {
+		return nil, fmt.Errorf("%s:%s is not an image index", r, tag)
+	}
+	return index, nil
+}
+
+func (r *OCIRegistry) getManifest(ctx context.Context, ref, mediaType string, v interface{}) error {
+	resp, err := r.request(ctx, http.MethodGet, "manifests/"+ref, "pull", http.Header{"Accept": {mediaType}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (r *OCIRegistry) pushManifest(ctx context.Context, ref string, m *ociManifest) (ociDescriptor, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	d := ociDescriptor{MediaType: m.MediaType, Digest: digest(b), Size: int64(len(b))}
+	if ref == "" {
+		ref = d.Digest
+	}
+	resp, err := r.request(ctx, http.MethodPut, "manifests/"+ref, "pull,push", http.Header{"Content-Type": {m.MediaType}}, b)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	resp.Body.Close()
+	return d, nil
+}
+
+func (r *OCIRegistry) pushBlob(ctx context.Context, mediaType string, b []byte) (ociDescriptor, error) {
+	d := ociDescriptor{MediaType: mediaType, Digest: digest(b), Size: int64(len(b))}
+	if resp, err := r.request(ctx, http.MethodHead, "blobs/"+d.Digest, "pull,push", nil, nil); err == nil {
+		resp.Body.Close()
+		return d, nil
+	} else if !isNotFound(err) {
+		return ociDescriptor{}, err
+	}
+
+	resp, err := r.request(ctx, http.MethodPost, "blobs/uploads/", "pull,push", nil, nil)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	resp.Body.Close()
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	query := location.Query()
+	query.Set("digest", d.Digest)
+	location.RawQuery = query.Encode()
+	resp, err = r.requestURL(ctx, http.MethodPut, location.String(), "pull,push", http.Header{"Content-Type": {"application/octet-stream"}}, b)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	resp.Body.Close()
+	return d, nil
+}
+
+// request sends a request to path below the repository, e.g. manifests/latest.
+func (r *OCIRegistry) request(ctx context.Context, method, path, actions string, header http.Header, body []byte) (*http.Response, error) {
+	u := strings.TrimSuffix(r.Registry, "/") + "/v2/" + r.Repository + "/" + path
+	return r.requestURL(ctx, method, u, actions, header, body)
+}
+
+// requestURL sends a request authenticated for the given actions on the
+// repository. On a 401 response with a bearer challenge a token is fetched
+// and the request is sent once more. Responses with a status code other
+// than 2xx result in a StatusError.
+func (r *OCIRegistry) requestURL(ctx context.Context, method, u, actions string, header http.Header, body []byte) (*http.Response, error) {
+	scope := "repository:" + r.Repository + ":" + actions
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		r.mu.Lock()
+		token := r.tokens[scope]
+		r.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if r.Username != "" {
+			req.SetBasicAuth(r.Username, r.Password)
+		}
+
+		if resp, err = r.requester().send(req); err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			break
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			break
+		}
+		resp.Body.Close()
+		if err := r.authenticate(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &StatusError{URL: u, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// authenticate fetches a token for scope from the realm of a bearer challenge.
+func (r *OCIRegistry) authenticate(ctx context.Context, challenge, scope string) error {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid authentication challenge %q", challenge)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	body, err := r.requester().do(req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	var tokens struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(body).Decode(&tokens); err != nil {
+		return err
+	}
+	token := tokens.Token
+	if token == "" {
+		token = tokens.AccessToken
+	}
+	if token == "" {
+		return errors.New("registry returned no token")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens == nil {
+		r.tokens = map[string]string{}
+	}
+	r.tokens[scope] = token
+	return nil
+}
+
+func (r *OCIRegistry) requester() *HTTPRequester {
+	if r.Requester == nil {
+		return &HTTPRequester{}
+	}
+	return r.Requester
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a
+// WWW-Authenticate header.
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for s != "" {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimSpace(s[i+1:])
+		value := ""
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, s = s[1:end+1], s[end+2:]
+		} else if end := strings.Index(s, ","); end >= 0 {
+			value, s = s[:end], s[end:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry is a minimal in-process OCI registry for a single repository
+// requiring token authentication with user "user" and password "pass".
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	tags      map[string]string
+	uploads   int
+}
+
+func newTestRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	reg := &testRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}, types: map[string]string{}, tags: map[string]string{}}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+
+		if r.URL.Path == "/token" {
+			if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"token": "token-%s"}`, r.URL.Query().Get("scope"))
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-repository:tools/myapp:") {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test",scope="repository:tools/myapp:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/tools/myapp/")
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case strings.HasPrefix(path, "blobs/uploads/") && r.Method == http.MethodPost:
+			reg.uploads++
+			w.Header().Set("Location", fmt.Sprintf("/v2/tools/myapp/blobs/uploads/%d?state=x", reg.uploads))
+			w.WriteHeader(http.StatusAccepted)
+		case strings.HasPrefix(path, "blobs/uploads/") && r.Method == http.MethodPut:
+			d := r.URL.Query().Get("digest")
+			if d != digest(body) || r.URL.Query().Get("state") != "x" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reg.blobs[d] = body
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(path, "blobs/"):
+			b, ok := reg.blobs[strings.TrimPrefix(path, "blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		case strings.HasPrefix(path, "manifests/") && r.Method == http.MethodPut:
+			d := digest(body)
+			reg.manifests[d] = body
+			reg.types[d] = r.Header.Get("Content-Type")
+			if ref := strings.TrimPrefix(path, "manifests/"); ref != d {
+				reg.tags[ref] = d
+			}
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(path, "manifests/"):
+			ref := strings.TrimPrefix(path, "manifests/")
+			if d, ok := reg.tags[ref]; ok {
+				ref = d
+			}
+			b, ok := reg.manifests[ref]
+			if !ok || !strings.Contains(r.Header.Get("Accept"), reg.types[ref]) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", reg.types[ref])
+			w.Write(b)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv
+}
+
+func TestOCIRegistryPushAndFetch(t *testing.T) {
+	srv := newTestRegistry(t)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := NewOCIRegistry(srv.URL + "/tools/myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher.Username, publisher.Password = "user", "pass"
+	for _, release := range []struct{ version, platform, tag string }{
+		{"1.2", "linux-amd64", "latest"},
+		{"1.3", "linux-amd64", "latest"},
+		{"1.3", "windows-amd64", "latest"},
+		{"1.4-beta.1", "linux-amd64", "beta"},
+	} {
+		path := filepath.Join(dir, release.version+"-"+release.platform)
+		ioutil.WriteFile(path, []byte("binary "+release.version+" "+release.platform), 0755)
+		version := Info{Version: release.version, ReleaseNotes: "Notes of " + release.version}
+		if err := publisher.Push(context.Background(), version, path, release.platform, pk, release.tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updater := &Updater{
+		CurrentVersion: "1.2",
+		CmdName:        "myapp",
+		Platform:       "linux-amd64",
+		PublicKey:      &pk.PublicKey,
+		Source:         &OCIRegistry{Registry: srv.URL, Repository: "tools/myapp", Username: "user", Password: "pass"},
+	}
+	info, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	equals(t, "Notes of 1.3", info.ReleaseNotes)
+	bin, err := updater.fetchAndVerifyFullBin(context.Background(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "binary 1.3 linux-amd64", string(bin))
+
+	updater.Channel = "beta"
+	if info, err = updater.GetNextVersion(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4-beta.1", info.Version)
+
+	updater.Channel = ""
+	updater.Platform = "darwin-arm64"
+	if info, err = updater.GetNextVersion(); err != nil || info.Version != "" {
+		t.Errorf("expected no update for a missing platform, got %#v %v", info, err)
+	}
+}
+
+func TestOCIRegistryRequiresCredentials(t *testing.T) {
+	srv := newTestRegistry(t)
+	defer srv.Close()
+
+	registry := &OCIRegistry{Registry: srv.URL, Repository: "tools/myapp"}
+	if _, err := registry.FetchInfo(context.Background(), "myapp", "linux-amd64", ""); err == nil {
+		t.Error("expected an error without credentials")
+	}
+	if _, err := NewOCIRegistry("myapp"); err == nil {
+		t.Error("expected an error for a reference without repository")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`realm="https://auth.example.com/token",service="registry.example.com",scope="repository:tools/myapp:pull,push"`)
+	equals(t, "https://auth.example.com/token", params["realm"])
+	equals(t, "registry.example.com", params["service"])
+	equals(t, "repository:tools/myapp:pull,push", params["scope"])
+}
@@ -0,0 +1,75 @@
+// Package otel records the spans of go-selfupdate with OpenTelemetry.
+//
+// Example:
+//
+//  updater.Tracer = selfupdateotel.NewTracer(otel.GetTracerProvider())
+package otel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/silthus/go-selfupdate/selfupdate"
+)
+
+const tracerName = "github.com/silthus/go-selfupdate/selfupdate"
+
+// Tracer is a selfupdate.Tracer starting OpenTelemetry spans and
+// propagating them in traceparent headers.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a tracer starting the spans with provider.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(tracerName)}
+}
+
+// Start implements selfupdate.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...selfupdate.Attribute) (context.Context, selfupdate.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithAttributes(keyValues(attrs)...))
+	return ctx, span{s}
+}
+
+// Inject implements selfupdate.Tracer.
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// span is a selfupdate.Span of an OpenTelemetry span.
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs ...selfupdate.Attribute) {
+	s.span.SetAttributes(keyValues(attrs)...)
+}
+
+func (s span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func keyValues(attrs []selfupdate.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,64 @@
+package otel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/silthus/go-selfupdate/selfupdate"
+)
+
+func TestTracerRecordsSpans(t *testing.T) {
+	for _, name := range []string{"DISABLE", "CHANNEL", "PIN", "URL", "MIRRORS", "CHECK_TIME"} {
+		t.Setenv("MYAPP_SELFUPDATE_"+name, "")
+	}
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	updater := &selfupdate.Updater{
+		CurrentVersion: "1.2",
+		ApiURL:         server.URL + "/",
+		CmdName:        "myapp",
+		Platform:       "linux-amd64",
+		PolicyFile:     filepath.Join(t.TempDir(), "policy.json"),
+		Tracer:         NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+	}
+	if _, err := updater.Update(); err == nil {
+		t.Fatal("expected an error without manifest")
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	update, fetch := spans["selfupdate.Update"], spans["selfupdate.FetchManifest"]
+	if fetch.Parent.SpanID() != update.SpanContext.SpanID() {
+		t.Errorf("expected selfupdate.FetchManifest to be a child of selfupdate.Update, got %v", exporter.GetSpans())
+	}
+	if update.Status.Code != codes.Error || fetch.Status.Code != codes.Error {
+		t.Errorf("expected the spans to fail, got %v %v", update.Status, fetch.Status)
+	}
+	var current string
+	for _, a := range update.Attributes {
+		if a.Key == "selfupdate.current_version" {
+			current = a.Value.AsString()
+		}
+	}
+	if current != "1.2" {
+		t.Errorf("expected the current version, got %q", current)
+	}
+	if traceparent == "" || !strings.Contains(traceparent, update.SpanContext.TraceID().String()) {
+		t.Errorf("expected the request to carry the trace, got %q", traceparent)
+	}
+}
@@ -0,0 +1,144 @@
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	pendingPath     = "pending"
+	pendingInfoPath = "pending.json"
+)
+
+// pendingInfo is the manifest of a staged update as written to
+// pending.json.
+type pendingInfo struct {
+	Info
+	Chosen bool `json:",omitempty"` // Version asked for with UpdateTo or Pin, installed even if it isn't newer.
+}
+
+// PendingUpdate returns the manifest of the update staged with DeferApply,
+// if there is one.
+func (u *Updater) PendingUpdate() (Info, bool) {
+	pending, ok := u.readPending()
+	return pending.Info, ok
+}
+
+func (u *Updater) readPending() (pendingInfo, bool) {
+	b, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + pendingInfoPath))
+	if err != nil {
+		return pendingInfo{}, false
+	}
+	pending := pendingInfo{}
+	if err := json.Unmarshal(b, &pending); err != nil || pending.Version == "" {
+		return pendingInfo{}, false
+	}
+	return pending, true
+}
+
+// CancelPending removes the update staged with DeferApply.
+func (u *Updater) CancelPending() error {
+	release, ok, err := u.lock()
+	if err != nil || !ok {
+		return err
+	}
+	defer release()
+
+	return u.removePending()
+}
+
+// ApplyPending installs the update staged with DeferApply and returns its
+// manifest, or an empty Info if nothing is staged. Call it early in main,
+// before any work starts, and restart the app if a version is returned, or
+// at exit.
+//
+// The staged binary is verified again against the hash of its manifest and
+// the PublicKey before it is installed. A binary failing verification is
+// removed, as is the current version and a version that isn't newer than
+// CurrentVersion, unless it was asked for with UpdateTo or Pin.
+func (u *Updater) ApplyPending() (Info, error) {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return Info{}, err
+	}
+	release, ok, err := u.lock()
+	if err != nil || !ok {
+		return Info{}, err
+	}
+	defer release()
+
+	start := time.Now()
+	ctx, span := u.startSpan(context.Background(), "selfupdate.ApplyPending", attrCurrentVersion.String(u.CurrentVersion))
+	pending, _ := u.PendingUpdate()
+	info, err := u.applyPending(ctx)
+	result := resultOf(info, err, false, false)
+	u.recordResult(result, info)
+	u.reportApply(start, pending, result, err)
+	span.SetAttributes(attrVersion.String(pending.Version), attrResult.String(result))
+	span.End(err)
+	return info, err
+}
+
+func (u *Updater) applyPending(ctx context.Context) (Info, error) {
+	pending, ok := u.readPending()
+	if !ok {
+		return Info{}, nil
+	}
+	info := pending.Info
+	// the app may have been updated otherwise since the version was staged
+	if info.Version == u.CurrentVersion || !pending.Chosen && compareVersions(info.Version, u.CurrentVersion) <= 0 {
+		return Info{}, u.removePending()
+	}
+	if u.PublicKey != nil && info.Signature == nil {
+		_ = u.removePending()
+		return Info{}, fmt.Errorf("update: configured with public key but pending update had no signature")
+	}
+	bin, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + pendingPath))
+	if err != nil {
+		return Info{}, err
+	}
+	if err := u.verifyContext(ctx, bin, info); err != nil {
+		_ = u.removePending()
+		return Info{}, err
+	}
+	if ok, err := u.consent(u.BeforeInstall, info); !ok {
+		if err == nil && u.isSkipped(info) {
+			err = u.removePending()
+		}
+		return Info{}, err
+	}
+	if err := u.install(ctx, bin, info); err != nil {
+		return Info{}, err
+	}
+	return info, u.removePending()
+}
+
+// stage writes the verified binary bin of version info to Dir, chosen if it
+// was asked for with UpdateTo or Pin. The manifest is written last, so only
+// complete binaries are pending.
+func (u *Updater) stage(bin []byte, info Info, chosen bool) error {
+	if err := u.removePending(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(u.getExecRelativeDir(u.Dir+pendingPath), bin, 0600); err != nil {
+		return err
+	}
+	b, err := json.Marshal(pendingInfo{Info: info, Chosen: chosen})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(u.getExecRelativeDir(u.Dir+pendingInfoPath), b, 0644)
+}
+
+func (u *Updater) removePending() error {
+	for _, name := range []string{pendingInfoPath, pendingPath} {
+		if err := os.Remove(u.getExecRelativeDir(u.Dir + name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUpdaterDeferApply(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	oldBin, newBin := []byte("old binary"), []byte("new binary")
+	release.publish(Info{Version: "1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3"}, "linux-amd64", newBin)
+
+	updater := release.updater("1.2", oldBin)
+	updater.DeferApply = true
+	if info, err := updater.ApplyPending(); err != nil || info.Version != "" {
+		t.Errorf("expected nothing to apply, got %#v %v", info, err)
+	}
+
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	if bin, _ := ioutil.ReadFile(updater.Target); !bytes.Equal(oldBin, bin) {
+		t.Error("expected a deferred update not to replace the target")
+	}
+	pending, ok := updater.PendingUpdate()
+	equals(t, true, ok)
+	equals(t, "1.3", pending.Version)
+
+	// a staged binary is verified again before it is installed
+	ioutil.WriteFile(updater.getExecRelativeDir(updater.Dir+pendingPath), []byte("tampered"), 0600)
+	if _, err := updater.ApplyPending(); err != ErrHashMismatch {
+		t.Errorf("expected ErrHashMismatch, got %v", err)
+	}
+	if _, ok := updater.PendingUpdate(); ok {
+		t.Error("expected a tampered update to be removed")
+	}
+
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := updater.CancelPending(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := updater.PendingUpdate(); ok {
+		t.Error("expected the pending update to be canceled")
+	}
+
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = updater.ApplyPending(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	if bin, _ := ioutil.ReadFile(updater.Target); !bytes.Equal(newBin, bin) {
+		t.Error("expected the pending update to replace the target")
+	}
+	if _, ok := updater.PendingUpdate(); ok {
+		t.Error("expected the applied update to be removed")
+	}
+
+	// a version staged before the app was updated otherwise isn't installed
+	ioutil.WriteFile(updater.Target, oldBin, 0755)
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	updater.CurrentVersion = "1.4"
+	if info, err = updater.ApplyPending(); err != nil || info.Version != "" {
+		t.Errorf("expected nothing to apply, got %#v %v", info, err)
+	}
+	if bin, _ := ioutil.ReadFile(updater.Target); !bytes.Equal(oldBin, bin) {
+		t.Error("expected an older staged version not to replace the target")
+	}
+	if _, ok := updater.PendingUpdate(); ok {
+		t.Error("expected the older staged version to be removed")
+	}
+}
+
+func TestUpdaterDeferApplyDowngrade(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	release.publishVersions("linux-amd64", "1.2", "1.3")
+
+	updater := release.updater("1.3", []byte("binary 1.3"))
+	updater.DeferApply = true
+	if _, err := updater.UpdateTo("1.2"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := updater.ApplyPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.2", info.Version)
+	bin, _ := ioutil.ReadFile(updater.Target)
+	equals(t, "binary 1.2", string(bin))
+
+	// a pinned version is kept the same way
+	ioutil.WriteFile(updater.Target, []byte("binary 1.3"), 0755)
+	updater.Pin = "1.2"
+	if info, err = updater.Update(); err != nil || info.Version != "1.2" {
+		t.Fatalf("expected 1.2 to be staged, got %#v %v", info, err)
+	}
+	if info, err = updater.ApplyPending(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.2", info.Version)
+	bin, _ = ioutil.ReadFile(updater.Target)
+	equals(t, "binary 1.2", string(bin))
+}
@@ -0,0 +1,70 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// UpdateTo installs version, or the version a channel of the index points
+// at, even if it is older than CurrentVersion. The manifest of version is
+// read from the index, see ResolveVersion, and the binary is verified
+// against it like any update. Pin and skipped versions are ignored.
+func (u *Updater) UpdateTo(version string) (info Info, err error) {
+	u, err = u.applyPolicy()
+	if err != nil {
+		return Info{}, err
+	}
+	release, ok, err := u.lock()
+	if err != nil || !ok {
+		return Info{}, err
+	}
+	defer release()
+	var target Info
+	start := time.Now()
+	ctx, span := u.startUpdateSpan(context.Background(), "selfupdate.UpdateTo")
+	defer func() { u.endUpdate(span, start, target, info, err) }()
+
+	if target, err = u.ResolveVersion(version); err != nil {
+		return Info{}, err
+	}
+	return u.apply(ctx, target, true)
+}
+
+// pinAllows reports whether Pin allows to install version.
+func (u *Updater) pinAllows(version string) bool {
+	if u.Pin == "" {
+		return true
+	}
+	matches, err := parsePin(u.Pin)
+	return err == nil && matches(version)
+}
+
+// pinnedInfo returns the newest version matching Pin. It is latest if it
+// matches, otherwise the index is searched. An empty Info is returned if
+// no other version matches but the current one does.
+func (u *Updater) pinnedInfo(latest Info) (Info, error) {
+	matches, err := parsePin(u.Pin)
+	if err != nil {
+		return Info{}, err
+	}
+	if latest.Version != "" && matches(latest.Version) {
+		return latest, nil
+	}
+	versions, err := u.ListVersions()
+	if err != nil {
+		if matches(u.CurrentVersion) {
+			return Info{}, nil
+		}
+		return Info{}, err
+	}
+	for _, info := range versions {
+		if matches(info.Version) {
+			return info, nil
+		}
+	}
+	if matches(u.CurrentVersion) {
+		return Info{}, nil
+	}
+	return Info{}, fmt.Errorf("no version matches pin %s", u.Pin)
+}
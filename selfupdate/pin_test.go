@@ -0,0 +1,61 @@
+package selfupdate
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestUpdaterUpdatesToPinnedVersions(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	release.publishVersions("linux-amd64", "1.2", "1.4.1", "1.4.2", "1.5")
+
+	updater := release.updater("1.5", []byte("binary 1.5"))
+	target := updater.Target
+	info, err := updater.UpdateTo("1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.2", info.Version)
+	bin, _ := ioutil.ReadFile(target)
+	equals(t, "binary 1.2", string(bin))
+
+	updater.CurrentVersion = "1.2"
+	updater.Pin = "1.4.x"
+	result, err := updater.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4.2", result.Version)
+	version, err := updater.UpdateAvailable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4.2", version)
+	next, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4.2", next.Version)
+	if info, err = updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4.2", info.Version)
+	bin, _ = ioutil.ReadFile(target)
+	equals(t, "binary 1.4.2", string(bin))
+
+	updater.CurrentVersion = "1.4.2"
+	if info, err = updater.Update(); err != nil || info.Version != "" {
+		t.Errorf("expected the pin to hold 1.4.2, got %#v %v", info, err)
+	}
+	if version, err = updater.UpdateAvailable(); err != nil || version != "" {
+		t.Errorf("expected no update available past the pin, got %q %v", version, err)
+	}
+
+	updater.Pin = "1.3"
+	if _, err = updater.Update(); err == nil {
+		t.Error("expected an error for a pin without matching version")
+	}
+	if _, err = updater.UpdateTo("2.0"); err == nil {
+		t.Error("expected an error updating to a missing version")
+	}
+}
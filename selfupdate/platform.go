@@ -0,0 +1,190 @@
+package selfupdate
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnknownFormat is returned by DetectPlatform for files that are no ELF,
+// Mach-O or PE executables.
+var ErrUnknownFormat = errors.New("unknown executable format")
+
+// elfOSes can't be told apart from the header of an ELF executable without
+// OS specific ABI or notes, DetectPlatform reports them as linux.
+var elfOSes = map[string]bool{"linux": true, "android": true, "dragonfly": true, "illumos": true, "solaris": true}
+
+// knownOSes and knownArches are the values of GOOS and GOARCH. Platforms
+// naming anything else are custom names that aren't checked.
+var (
+	knownOSes = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+		"illumos": true, "ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true, "openbsd": true,
+		"plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+	knownArches = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true, "arm64be": true,
+		"loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true, "mips64p32": true,
+		"mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true,
+		"s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
+
+// DetectPlatform reads the header of an ELF, Mach-O or PE executable and
+// returns its platform like linux-amd64. Executables of several OSes using
+// ELF, like android or solaris, are reported as linux. Universal Mach-O
+// binaries are reported with the architecture of their first image.
+func DetectPlatform(r io.ReaderAt) (string, error) {
+	platforms, err := detectPlatforms(r)
+	if err != nil {
+		return "", err
+	}
+	return platforms[0], nil
+}
+
+// CheckPlatform returns an error if r is an ELF, Mach-O or PE executable not
+// targeting platform. Files in other formats, like scripts, and platforms
+// that aren't a known GOOS-GOARCH pair, like prod-server, pass.
+func CheckPlatform(r io.ReaderAt, platform string) error {
+	goos, goarch := splitPlatform(platform)
+	if !knownOSes[goos] || !knownArches[goarch] {
+		return nil
+	}
+	platforms, err := detectPlatforms(r)
+	if err == ErrUnknownFormat {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range platforms {
+		binOS, binArch := splitPlatform(p)
+		if binArch == goarch && (binOS == goos || (binOS == "linux" && elfOSes[goos]) || (binOS == "darwin" && goos == "ios")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("binary for %s can't run on %s", platforms[0], platform)
+}
+
+func detectPlatforms(r io.ReaderAt) ([]string, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, ErrUnknownFormat
+	}
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		return detectELF(r)
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		return detectPE(r)
+	}
+	if fat, err := macho.NewFatFile(r); err == nil {
+		var platforms []string
+		for _, arch := range fat.Arches {
+			if p, err := machoPlatform(arch.Cpu); err == nil {
+				platforms = append(platforms, p)
+			}
+		}
+		if len(platforms) == 0 {
+			return nil, fmt.Errorf("universal binary without supported architecture")
+		}
+		return platforms, nil
+	}
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	p, err := machoPlatform(f.Cpu)
+	if err != nil {
+		return nil, err
+	}
+	return []string{p}, nil
+}
+
+func detectELF(r io.ReaderAt) ([]string, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	goos := "linux"
+	switch {
+	case f.OSABI == elf.ELFOSABI_FREEBSD:
+		goos = "freebsd"
+	case f.OSABI == elf.ELFOSABI_SOLARIS:
+		goos = "solaris"
+	case f.Section(".note.netbsd.ident") != nil:
+		goos = "netbsd"
+	case f.Section(".note.openbsd.ident") != nil:
+		goos = "openbsd"
+	}
+
+	var arch string
+	le := f.Data == elf.ELFDATA2LSB
+	switch f.Machine {
+	case elf.EM_386:
+		arch = "386"
+	case elf.EM_X86_64:
+		arch = "amd64"
+	case elf.EM_ARM:
+		arch = "arm"
+	case elf.EM_AARCH64:
+		arch = "arm64"
+	case elf.EM_RISCV:
+		arch = "riscv64"
+	case elf.EM_S390:
+		arch = "s390x"
+	case elf.EM_PPC64:
+		arch = "ppc64"
+		if le {
+			arch = "ppc64le"
+		}
+	case elf.EM_MIPS:
+		arch = "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch = "mips64"
+		}
+		if le {
+			arch += "le"
+		}
+	case elf.Machine(258): // EM_LOONGARCH
+		arch = "loong64"
+	default:
+		return nil, fmt.Errorf("unsupported ELF machine %v", f.Machine)
+	}
+	return []string{goos + "-" + arch}, nil
+}
+
+func detectPE(r io.ReaderAt) ([]string, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return []string{"windows-386"}, nil
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return []string{"windows-amd64"}, nil
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return []string{"windows-arm"}, nil
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return []string{"windows-arm64"}, nil
+	}
+	return nil, fmt.Errorf("unsupported PE machine %#x", f.Machine)
+}
+
+func machoPlatform(cpu macho.Cpu) (string, error) {
+	switch cpu {
+	case macho.Cpu386:
+		return "darwin-386", nil
+	case macho.CpuAmd64:
+		return "darwin-amd64", nil
+	case macho.CpuArm:
+		return "darwin-arm", nil
+	case macho.CpuArm64:
+		return "darwin-arm64", nil
+	}
+	return "", fmt.Errorf("unsupported Mach-O cpu %v", cpu)
+}
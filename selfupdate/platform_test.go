@@ -0,0 +1,107 @@
+package selfupdate
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func elfHeader(machine elf.Machine, osabi elf.OSABI) []byte {
+	h := make([]byte, 64)
+	copy(h, elf.ELFMAG)
+	h[elf.EI_CLASS], h[elf.EI_DATA], h[elf.EI_VERSION], h[elf.EI_OSABI] = byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), 1, byte(osabi)
+	binary.LittleEndian.PutUint16(h[16:], uint16(elf.ET_EXEC))
+	binary.LittleEndian.PutUint16(h[18:], uint16(machine))
+	binary.LittleEndian.PutUint32(h[20:], 1)
+	binary.LittleEndian.PutUint16(h[52:], 64)
+	binary.LittleEndian.PutUint16(h[54:], 56)
+	binary.LittleEndian.PutUint16(h[58:], 64)
+	return h
+}
+
+func peHeader(machine uint16) []byte {
+	h := make([]byte, 512)
+	copy(h, "MZ")
+	binary.LittleEndian.PutUint32(h[0x3c:], 64)
+	copy(h[64:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(h[68:], machine)
+	return h
+}
+
+func machoHeader(cpu macho.Cpu) []byte {
+	h := make([]byte, 32)
+	binary.LittleEndian.PutUint32(h, macho.Magic64)
+	binary.LittleEndian.PutUint32(h[4:], uint32(cpu))
+	binary.LittleEndian.PutUint32(h[12:], uint32(macho.TypeExec))
+	return h
+}
+
+func TestDetectPlatform(t *testing.T) {
+	for _, test := range []struct {
+		header   []byte
+		platform string
+	}{
+		{elfHeader(elf.EM_X86_64, elf.ELFOSABI_NONE), "linux-amd64"},
+		{elfHeader(elf.EM_AARCH64, elf.ELFOSABI_NONE), "linux-arm64"},
+		{elfHeader(elf.EM_X86_64, elf.ELFOSABI_FREEBSD), "freebsd-amd64"},
+		{peHeader(pe.IMAGE_FILE_MACHINE_AMD64), "windows-amd64"},
+		{peHeader(pe.IMAGE_FILE_MACHINE_I386), "windows-386"},
+		{machoHeader(macho.CpuArm64), "darwin-arm64"},
+	} {
+		platform, err := DetectPlatform(bytes.NewReader(test.header))
+		if err != nil {
+			t.Errorf("DetectPlatform for %s failed: %v", test.platform, err)
+		}
+		equals(t, test.platform, platform)
+	}
+
+	if _, err := DetectPlatform(bytes.NewReader([]byte("#!/bin/sh\n"))); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := CheckPlatform(f, runtime.GOOS+"-"+runtime.GOARCH); err != nil {
+		t.Errorf("expected the test binary to match its platform, got %v", err)
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	linux := elfHeader(elf.EM_X86_64, elf.ELFOSABI_NONE)
+	for _, test := range []struct {
+		bin      []byte
+		platform string
+		ok       bool
+	}{
+		{linux, "linux-amd64", true},
+		{linux, "android-amd64", true},
+		{linux, "linux-arm64", false},
+		{linux, "windows-amd64", false},
+		{elfHeader(elf.EM_X86_64, elf.ELFOSABI_FREEBSD), "linux-amd64", false},
+		{peHeader(pe.IMAGE_FILE_MACHINE_AMD64), "windows-amd64", true},
+		{peHeader(pe.IMAGE_FILE_MACHINE_AMD64), "darwin-amd64", false},
+		{machoHeader(macho.CpuAmd64), "darwin-arm64", false},
+		{[]byte("#!/bin/sh\n"), "linux-amd64", true},
+		{linux, "custom", true},
+		{linux, "prod-server", true},
+		{linux, "linux-x64", true},
+		{linux, "linux-arm64-v8", false},
+	} {
+		err := CheckPlatform(bytes.NewReader(test.bin), test.platform)
+		if (err == nil) != test.ok {
+			t.Errorf("CheckPlatform for %s returned %v", test.platform, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ErrUpdatesDisabled is returned if an administrator disabled updates, see
+// Policy.
+var ErrUpdatesDisabled = errors.New("updates are disabled by policy")
+
+// Policy overrides the configuration of an Updater without rebuilding the
+// app. It is read whenever updates are checked for from a system wide JSON
+// file, see Updater.PolicyFile, and from environment variables named after
+// CmdName, like MYAPP_SELFUPDATE_PIN for the command myapp:
+//
+//  MYAPP_SELFUPDATE_DISABLE=true
+//  MYAPP_SELFUPDATE_CHANNEL=beta
+//  MYAPP_SELFUPDATE_PIN=1.4.x
+//  MYAPP_SELFUPDATE_URL=https://updates.example.com/
+//  MYAPP_SELFUPDATE_MIRRORS=https://a.example.com/,https://b.example.com/
+//  MYAPP_SELFUPDATE_CHECK_TIME=24
+//
+// Environment variables take precedence over the file, except that either
+// of them can disable updates.
+type Policy struct {
+	Disabled  bool     `json:",omitempty"` // No updates are checked for or installed.
+	Channel   string   `json:",omitempty"` // Release channel replacing Channel.
+	Pin       string   `json:",omitempty"` // Version or range replacing Pin.
+	URL       string   `json:",omitempty"` // Base URL replacing ApiURL, BinURL, DiffURL, Source and, unless Mirrors is set, the mirrors.
+	Mirrors   []string `json:",omitempty"` // URLs replacing ApiMirrors, BinMirrors and DiffMirrors.
+	CheckTime int      `json:",omitempty"` // Hours replacing CheckTime.
+
+	Sources map[string]string `json:"-"` // File or environment variable each setting was read from, by its name.
+}
+
+// policyVars are the suffixes of the environment variables of the settings.
+var policyVars = map[string]string{
+	"Disabled":  "DISABLE",
+	"Channel":   "CHANNEL",
+	"Pin":       "PIN",
+	"URL":       "URL",
+	"Mirrors":   "MIRRORS",
+	"CheckTime": "CHECK_TIME",
+}
+
+// Policy reads the policy in effect for the Updater.
+func (u *Updater) Policy() (Policy, error) {
+	p := Policy{Sources: map[string]string{}}
+	path := u.getPolicyFile()
+	if b, err := ioutil.ReadFile(path); err == nil {
+		var fromFile Policy
+		if err := json.Unmarshal(b, &fromFile); err != nil {
+			return Policy{}, fmt.Errorf("%s: %v", path, err)
+		}
+		p.merge(fromFile, func(string) string { return path })
+	} else if !os.IsNotExist(err) {
+		return Policy{}, err
+	}
+
+	var fromEnv Policy
+	prefix := u.policyEnvPrefix()
+	vars := map[string]string{}
+	for setting, suffix := range policyVars {
+		if value, ok := os.LookupEnv(prefix + suffix); ok && value != "" {
+			vars[setting] = prefix + suffix
+		}
+	}
+	var err error
+	if name, ok := vars["Disabled"]; ok {
+		if fromEnv.Disabled, err = strconv.ParseBool(os.Getenv(name)); err != nil {
+			return Policy{}, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if name, ok := vars["CheckTime"]; ok {
+		if fromEnv.CheckTime, err = strconv.Atoi(os.Getenv(name)); err != nil {
+			return Policy{}, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	fromEnv.Channel = os.Getenv(vars["Channel"])
+	fromEnv.Pin = os.Getenv(vars["Pin"])
+	fromEnv.URL = os.Getenv(vars["URL"])
+	if name, ok := vars["Mirrors"]; ok {
+		for _, mirror := range strings.Split(os.Getenv(name), ",") {
+			if mirror = strings.TrimSpace(mirror); mirror != "" {
+				fromEnv.Mirrors = append(fromEnv.Mirrors, mirror)
+			}
+		}
+	}
+	p.merge(fromEnv, func(setting string) string { return vars[setting] })
+
+	if p.Pin != "" {
+		if _, err := parsePin(p.Pin); err != nil {
+			return Policy{}, fmt.Errorf("%s: %v", p.Sources["Pin"], err)
+		}
+	}
+	return p, nil
+}
+
+// merge overrides p with the settings set in o, read from source.
+func (p *Policy) merge(o Policy, source func(setting string) string) {
+	if o.Disabled {
+		p.Disabled = true
+		p.Sources["Disabled"] = source("Disabled")
+	}
+	if o.Channel != "" {
+		p.Channel = o.Channel
+		p.Sources["Channel"] = source("Channel")
+	}
+	if o.Pin != "" {
+		p.Pin = o.Pin
+		p.Sources["Pin"] = source("Pin")
+	}
+	if o.URL != "" {
+		p.URL = o.URL
+		p.Sources["URL"] = source("URL")
+	}
+	if len(o.Mirrors) > 0 {
+		p.Mirrors = o.Mirrors
+		p.Sources["Mirrors"] = source("Mirrors")
+	}
+	if o.CheckTime > 0 {
+		p.CheckTime = o.CheckTime
+		p.Sources["CheckTime"] = source("CheckTime")
+	}
+}
+
+// applyPolicy returns a copy of the Updater configured by its policy, or
+// ErrUpdatesDisabled.
+func (u *Updater) applyPolicy() (*Updater, error) {
+	if u.policy != nil {
+		return u, nil
+	}
+	p, err := u.Policy()
+	if err != nil {
+		return nil, err
+	}
+	if p.Disabled {
+		return nil, ErrUpdatesDisabled
+	}
+	c := *u
+	c.policy = &p
+	if p.Channel != "" {
+		c.Channel = p.Channel
+	}
+	if p.Pin != "" {
+		c.Pin = p.Pin
+	}
+	if p.URL != "" {
+		c.ApiURL, c.BinURL, c.DiffURL, c.Source = p.URL, p.URL, p.URL, nil
+		// the mirrors set in code serve the replaced URLs
+		c.ApiMirrors, c.BinMirrors, c.DiffMirrors = nil, nil, nil
+	}
+	if len(p.Mirrors) > 0 {
+		var mirrors []Mirror
+		for _, url := range p.Mirrors {
+			mirrors = append(mirrors, Mirror{URL: url})
+		}
+		c.ApiMirrors, c.BinMirrors, c.DiffMirrors = mirrors, mirrors, mirrors
+	}
+	if p.CheckTime > 0 {
+		c.CheckTime = p.CheckTime
+	}
+	return &c, nil
+}
+
+// policyDir is the directory of the policy files of all commands.
+var policyDir = func() string {
+	if runtime.GOOS == "windows" {
+		dir := os.Getenv("ProgramData")
+		// a relative path would read the policy from the working directory
+		if !filepath.IsAbs(dir) {
+			dir = `C:\ProgramData`
+		}
+		return filepath.Join(dir, "go-selfupdate")
+	}
+	return "/etc/go-selfupdate"
+}()
+
+func (u *Updater) getPolicyFile() string {
+	if u.PolicyFile != "" {
+		return u.PolicyFile
+	}
+	return filepath.Join(policyDir, u.CmdName+".json")
+}
+
+// policyEnvPrefix returns the prefix of the environment variables, like
+// MY_APP_SELFUPDATE_ for the command my-app.
+func (u *Updater) policyEnvPrefix() string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, u.CmdName)
+	if name == "" {
+		return "SELFUPDATE_"
+	}
+	return strings.ToUpper(name) + "_SELFUPDATE_"
+}
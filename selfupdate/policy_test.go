@@ -0,0 +1,79 @@
+package selfupdate
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdaterPolicy(t *testing.T) {
+	release := newTestRelease(t, "my-app")
+	release.publishVersions("linux-amd64", "1.2", "1.3", "1.4", "1.5")
+	if err := AssignChannel(release.genDir, "beta", "1.5", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	updater := release.updater("1.2", []byte("binary 1.2"))
+	updater.Source = nil
+	updater.ApiURL = "http://updates.invalid/"
+	updater.ApiMirrors = []Mirror{{URL: "http://mirror.invalid/"}}
+	policyFile := updater.PolicyFile
+	ioutil.WriteFile(policyFile, []byte(`{"Pin": "1.3", "CheckTime": 48}`), 0644)
+	server := httptest.NewServer(release.files())
+	defer server.Close()
+	t.Setenv("MY_APP_SELFUPDATE_URL", server.URL+"/")
+	t.Setenv("MY_APP_SELFUPDATE_CHANNEL", "beta")
+	policy, err := updater.Policy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", policy.Pin)
+	equals(t, 48, policy.CheckTime)
+	equals(t, "beta", policy.Channel)
+	equals(t, policyFile, policy.Sources["Pin"])
+	equals(t, "MY_APP_SELFUPDATE_CHANNEL", policy.Sources["Channel"])
+
+	// the URL of the policy replaces ApiURL and its mirrors
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	configured, err := updater.applyPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configured.ApiMirrors != nil {
+		t.Errorf("expected the policy URL to drop the mirrors, got %v", configured.ApiMirrors)
+	}
+
+	t.Setenv("MY_APP_SELFUPDATE_PIN", "1.4")
+	updater.CurrentVersion = "1.3"
+	if info, err = updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.4", info.Version)
+
+	// without pin the channel of the index selects the version
+	t.Setenv("MY_APP_SELFUPDATE_PIN", "")
+	ioutil.WriteFile(policyFile, []byte(`{"CheckTime": 48}`), 0644)
+	updater.CurrentVersion = "1.4"
+	if info, err = updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.5", info.Version)
+
+	t.Setenv("MY_APP_SELFUPDATE_CHANNEL", "alpha")
+	if _, err = updater.Update(); err == nil {
+		t.Error("expected an error for a channel missing from the index")
+	}
+
+	t.Setenv("MY_APP_SELFUPDATE_DISABLE", "true")
+	if _, err := updater.Update(); err != ErrUpdatesDisabled {
+		t.Errorf("expected ErrUpdatesDisabled, got %v", err)
+	}
+	equals(t, false, updater.WantUpdate())
+	if info, err := updater.BackgroundRun(); err != nil || info.Version != "" {
+		t.Errorf("expected BackgroundRun to do nothing, got %#v %v", info, err)
+	}
+}
@@ -0,0 +1,67 @@
+// Package prometheus exports the metrics of go-selfupdate to Prometheus.
+//
+// Example:
+//
+//  metrics := selfupdate.NewMetrics()
+//  updater.Metrics = metrics
+//  prometheus.MustRegister(selfupdateprom.NewCollector(metrics))
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/silthus/go-selfupdate/selfupdate"
+)
+
+var (
+	checksDesc = prom.NewDesc("selfupdate_checks_total",
+		"Number of update manifests fetched.", nil, nil)
+	resultsDesc = prom.NewDesc("selfupdate_results_total",
+		"Number of updates by result.", []string{"result"}, nil)
+	downloadedDesc = prom.NewDesc("selfupdate_downloaded_bytes_total",
+		"Bytes downloaded by kind of download.", []string{"kind"}, nil)
+	patchFallbacksDesc = prom.NewDesc("selfupdate_patch_fallbacks_total",
+		"Number of patches failing the hash check, replaced by the full binary.", nil, nil)
+	signatureFailuresDesc = prom.NewDesc("selfupdate_signature_failures_total",
+		"Number of binaries or indexes with a bad signature.", nil, nil)
+	installedDesc = prom.NewDesc("selfupdate_installed_version_info",
+		"Version installed, always 1.", []string{"version"}, nil)
+)
+
+// Collector is a prometheus.Collector exporting selfupdate.Metrics.
+type Collector struct {
+	metrics *selfupdate.Metrics
+}
+
+// NewCollector returns a collector exporting metrics.
+func NewCollector(metrics *selfupdate.Metrics) *Collector {
+	return &Collector{metrics: metrics}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- checksDesc
+	ch <- resultsDesc
+	ch <- downloadedDesc
+	ch <- patchFallbacksDesc
+	ch <- signatureFailuresDesc
+	ch <- installedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	s := c.metrics.Snapshot()
+	ch <- prom.MustNewConstMetric(checksDesc, prom.CounterValue, float64(s.Checks))
+	for _, result := range []string{selfupdate.ResultUpdated, selfupdate.ResultStaged, selfupdate.ResultDryRun,
+		selfupdate.ResultNoUpdate, selfupdate.ResultAborted, selfupdate.ResultFailed} {
+		ch <- prom.MustNewConstMetric(resultsDesc, prom.CounterValue, float64(s.Results[result]), result)
+	}
+	for _, kind := range []string{selfupdate.DownloadManifest, selfupdate.DownloadPatch, selfupdate.DownloadFull} {
+		ch <- prom.MustNewConstMetric(downloadedDesc, prom.CounterValue, float64(s.DownloadedBytes[kind]), kind)
+	}
+	ch <- prom.MustNewConstMetric(patchFallbacksDesc, prom.CounterValue, float64(s.PatchFallbacks))
+	ch <- prom.MustNewConstMetric(signatureFailuresDesc, prom.CounterValue, float64(s.SignatureFailures))
+	if s.InstalledVersion != "" {
+		ch <- prom.MustNewConstMetric(installedDesc, prom.GaugeValue, 1, s.InstalledVersion)
+	}
+}
@@ -0,0 +1,44 @@
+package prometheus
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/silthus/go-selfupdate/selfupdate"
+)
+
+func TestCollectorExportsMetrics(t *testing.T) {
+	metrics := selfupdate.NewMetrics()
+	for _, name := range []string{"DISABLE", "CHANNEL", "PIN", "URL", "MIRRORS", "CHECK_TIME"} {
+		t.Setenv("MYAPP_SELFUPDATE_"+name, "")
+	}
+	updater := &selfupdate.Updater{
+		CurrentVersion: "1.2",
+		CmdName:        "myapp",
+		PolicyFile:     filepath.Join(t.TempDir(), "policy.json"),
+		Metrics:        metrics,
+	}
+	if _, err := updater.GetNextVersion(); err == nil {
+		t.Fatal("expected an error without ApiURL")
+	}
+
+	expected := `
+# HELP selfupdate_checks_total Number of update manifests fetched.
+# TYPE selfupdate_checks_total counter
+selfupdate_checks_total 1
+# HELP selfupdate_installed_version_info Version installed, always 1.
+# TYPE selfupdate_installed_version_info gauge
+selfupdate_installed_version_info{version="1.2"} 1
+`
+	err := testutil.CollectAndCompare(NewCollector(metrics), strings.NewReader(expected),
+		"selfupdate_checks_total", "selfupdate_installed_version_info")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(NewCollector(metrics), "selfupdate_results_total"); n != 6 {
+		t.Errorf("expected a series per result, got %d", n)
+	}
+}
@@ -0,0 +1,373 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reportsPath          = "reports/"
+	installationIDPath   = "installation-id"
+	defaultMaxQueued     = 100
+	defaultReportTimeout = 30 * time.Second
+)
+
+// ReportSignatureHeader holds the base64 encoded RSA PKCS #1 v1.5 signature of
+// the SHA-256 hash of a report signed with Reporter.PrivateKey.
+const ReportSignatureHeader = "X-Selfupdate-Signature"
+
+// Events of reports.
+const (
+	ReportCheck = "check" // A manifest was fetched.
+	ReportApply = "apply" // An update was downloaded, staged or installed.
+)
+
+// ResultAvailable is the result of a check finding a version other than the
+// current one.
+const ResultAvailable = "available"
+
+// Reporter sends the outcome of checks and updates to a server, e.g. to
+// count the installations of each version and the reasons updates fail.
+//
+// Reports are queued in Dir after each check and after each update that
+// found a version, and POSTed as JSON in the background, so a slow server
+// doesn't hold up updates. Reports that can't be sent, or aren't sent
+// before the app exits, are sent with the next report.
+type Reporter struct {
+	URL            string          // Endpoint receiving the reports
+	InstallationID string          // Optional ID of the installation. Defaults to a random ID stored in Dir
+	PrivateKey     *rsa.PrivateKey // Optional key to sign reports with, see ReportSignatureHeader
+	Requester      *HTTPRequester  // Optional requester to configure proxies or TLS
+	MaxQueued      int             // Optional maximum number of unsent reports kept in Dir. Defaults to 100
+	Timeout        time.Duration   // Optional maximum time to send a report. Defaults to 30 seconds
+}
+
+// reportQueues are the queues in Dir reports are being sent from, so each
+// queue is sent by a single goroutine.
+var reportQueues = struct {
+	sync.Mutex
+	sending map[string]bool // Queues being sent.
+	again   map[string]bool // Queues with reports added while they were sent.
+	wg      sync.WaitGroup
+}{sending: map[string]bool{}, again: map[string]bool{}}
+
+// Report is the outcome of a check or update.
+type Report struct {
+	InstallationID string
+	Event          string    // ReportCheck or ReportApply.
+	FromVersion    string    // CurrentVersion of the Updater.
+	ToVersion      string    `json:",omitempty"` // Version found or installed.
+	Platform       string    // Platform of the manifest, like linux-amd64-v3.
+	Result         string    // Result like ResultUpdated, ResultAvailable or ResultFailed.
+	ErrorClass     string    `json:",omitempty"` // Kind of error like "network" or "signature_mismatch", see ErrorClass.
+	Error          string    `json:",omitempty"` // Message of the error.
+	Time           time.Time // Start of the check or update.
+	DurationMillis int64     // Duration of the check or update.
+}
+
+// ReadReport reads the report POSTed with r. If pk is set the report must
+// be signed with the matching private key.
+func ReadReport(r *http.Request, pk *rsa.PublicKey) (Report, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return Report{}, err
+	}
+	if pk != nil {
+		sig, err := base64.StdEncoding.DecodeString(r.Header.Get(ReportSignatureHeader))
+		if err != nil || !verifySignature(pk, body, sig) {
+			return Report{}, ErrSignatureMismatch
+		}
+	}
+	var report Report
+	if err := json.Unmarshal(body, &report); err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// ErrorClass returns a short name of the kind of err for reports:
+// "hash_mismatch", "signature_mismatch", "aborted", "disabled",
+// "lock_timeout", "not_found", "http_status", "network", "timeout",
+// "permission", "smoke_test", "install" or "other".
+func ErrorClass(err error) string {
+	var statusErr *StatusError
+	var netErr net.Error
+	var installErr *InstallError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrHashMismatch):
+		return "hash_mismatch"
+	case errors.Is(err, ErrSignatureMismatch):
+		return "signature_mismatch"
+	case errors.Is(err, ErrAborted):
+		return "aborted"
+	case errors.Is(err, ErrUpdatesDisabled):
+		return "disabled"
+	case errors.Is(err, ErrLockTimeout):
+		return "lock_timeout"
+	case isMissing(err):
+		return "not_found"
+	case errors.As(err, &statusErr):
+		return "http_status"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case errors.As(err, &installErr):
+		if installErr.Op == "smoke test" {
+			return "smoke_test"
+		}
+		return "install"
+	}
+	return "other"
+}
+
+// reportCheck reports the check that started at start and fetched info.
+func (u *Updater) reportCheck(start time.Time, info Info, err error) {
+	result := ResultNoUpdate
+	switch {
+	case err != nil:
+		result = ResultFailed
+	case info.Version != "" && info.Version != u.CurrentVersion:
+		result = ResultAvailable
+	}
+	u.report(ReportCheck, start, info, result, err)
+}
+
+// reportApply reports the update that started at start, unless it found
+// nothing to do.
+func (u *Updater) reportApply(start time.Time, info Info, result string, err error) {
+	if result != ResultNoUpdate {
+		u.report(ReportApply, start, info, result, err)
+	}
+}
+
+func (u *Updater) report(event string, start time.Time, info Info, result string, err error) {
+	if u.Reporter == nil {
+		return
+	}
+	report := Report{
+		InstallationID: u.installationID(),
+		Event:          event,
+		FromVersion:    u.CurrentVersion,
+		ToVersion:      info.Version,
+		Platform:       u.platformFor(info),
+		Result:         result,
+		ErrorClass:     ErrorClass(err),
+		Time:           start,
+		DurationMillis: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if err := u.queueReport(report); err != nil {
+		return
+	}
+	u.reportSender().start()
+}
+
+// installationID returns the ID set on the Reporter, or the one stored in
+// Dir, creating it on first use.
+func (u *Updater) installationID() string {
+	if u.Reporter.InstallationID != "" {
+		return u.Reporter.InstallationID
+	}
+	path := u.getExecRelativeDir(u.Dir + installationIDPath)
+	if b, err := ioutil.ReadFile(path); err == nil && len(bytes.TrimSpace(b)) > 0 {
+		return string(bytes.TrimSpace(b))
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	s := hex.EncodeToString(id)
+	_ = os.MkdirAll(u.getExecRelativeDir(u.Dir), 0777)
+	_ = ioutil.WriteFile(path, []byte(s), 0644)
+	return s
+}
+
+// queueReport writes report to the queue in Dir, dropping the oldest
+// reports beyond MaxQueued.
+func (u *Updater) queueReport(report Report) error {
+	dir := u.getExecRelativeDir(u.Dir + reportsPath)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := fmt.Sprintf("%020d-%x.json", time.Now().UnixNano(), suffix)
+	// renamed into place so only complete reports are sent
+	tmp := filepath.Join(dir, name+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	max := u.Reporter.MaxQueued
+	if max <= 0 {
+		max = defaultMaxQueued
+	}
+	queued := queuedReports(dir)
+	for len(queued) > max {
+		_ = os.Remove(filepath.Join(dir, queued[0]))
+		queued = queued[1:]
+	}
+	return nil
+}
+
+// reportSender sends the reports queued in dir to url.
+type reportSender struct {
+	dir       string
+	url       string
+	key       *rsa.PrivateKey
+	requester *HTTPRequester
+	timeout   time.Duration
+}
+
+// reportSender returns the sender of the reports of the Updater, which
+// doesn't share state with it.
+func (u *Updater) reportSender() *reportSender {
+	timeout := u.Reporter.Timeout
+	if timeout <= 0 {
+		timeout = defaultReportTimeout
+	}
+	return &reportSender{
+		dir:       u.getExecRelativeDir(u.Dir + reportsPath),
+		url:       u.Reporter.URL,
+		key:       u.Reporter.PrivateKey,
+		requester: u.withUserAgent(u.Reporter.Requester),
+		timeout:   timeout,
+	}
+}
+
+// start sends the queued reports in the background. If they are being sent
+// already, they are sent again once that is done.
+func (s *reportSender) start() {
+	reportQueues.Lock()
+	defer reportQueues.Unlock()
+	if reportQueues.sending[s.dir] {
+		reportQueues.again[s.dir] = true
+		return
+	}
+	reportQueues.sending[s.dir] = true
+	reportQueues.wg.Add(1)
+	go func() {
+		defer reportQueues.wg.Done()
+		for {
+			s.send()
+			reportQueues.Lock()
+			if !reportQueues.again[s.dir] {
+				delete(reportQueues.sending, s.dir)
+				reportQueues.Unlock()
+				return
+			}
+			delete(reportQueues.again, s.dir)
+			reportQueues.Unlock()
+		}
+	}()
+}
+
+// send sends the queued reports oldest first and removes them once they
+// are sent. Sending stops at the first failure.
+func (s *reportSender) send() {
+	for _, name := range queuedReports(s.dir) {
+		path := filepath.Join(s.dir, name)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if err := s.sendReport(b); err != nil && !isRejected(err) {
+			return
+		}
+		_ = os.Remove(path)
+	}
+}
+
+func (s *reportSender) sendReport(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.key != nil {
+		hash := sha256.Sum256(body)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+		if err != nil {
+			return err
+		}
+		req.Header.Set(ReportSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+	}
+	resp, err := s.requester.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// isRejected reports whether the server refused a report for good, so it
+// is dropped instead of being sent again.
+func isRejected(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	code := statusErr.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// queuedReports returns the names of the reports queued in dir, oldest
+// first.
+func queuedReports(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
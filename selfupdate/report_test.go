@@ -0,0 +1,167 @@
+package selfupdate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdaterReportsOutcomes(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	release.publishVersions("linux-amd64", "1.2", "1.3")
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var reports []Report
+	down := true
+	reporting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		report, err := ReadReport(r, &pk.PublicKey)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reports = append(reports, report)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reporting.Close()
+
+	updater := release.updater("1.2", []byte("binary 1.2"))
+	updater.Reporter = &Reporter{URL: reporting.URL, PrivateKey: pk}
+	release.serve(updater, release.files())
+	target := updater.Target
+	if _, err := updater.Check(); err != nil {
+		t.Fatal(err)
+	}
+	waitForReports()
+	queue := updater.getExecRelativeDir(updater.Dir + reportsPath)
+	equals(t, 1, len(queuedReports(queue)))
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+	waitForReports()
+	equals(t, 0, len(queuedReports(queue)))
+	equals(t, 3, len(reports))
+	for i, want := range []struct{ event, result string }{
+		{ReportCheck, ResultAvailable},
+		{ReportCheck, ResultAvailable},
+		{ReportApply, ResultUpdated},
+	} {
+		r := reports[i]
+		equals(t, want.event, r.Event)
+		equals(t, want.result, r.Result)
+		equals(t, "1.2", r.FromVersion)
+		equals(t, "1.3", r.ToVersion)
+		equals(t, "linux-amd64", r.Platform)
+		equals(t, reports[0].InstallationID, r.InstallationID)
+	}
+	if len(reports[0].InstallationID) != 32 {
+		t.Errorf("expected a random installation ID, got %q", reports[0].InstallationID)
+	}
+
+	// failures are reported with the version and the class of the error
+	ioutil.WriteFile(target, []byte("binary 1.2"), 0755)
+	os.Remove(filepath.Join(release.genDir, "1.3", "linux-amd64.gz"))
+	os.RemoveAll(filepath.Join(release.genDir, "1.2"))
+	if _, err := updater.Update(); err == nil {
+		t.Fatal("expected the update to fail without binary")
+	}
+	waitForReports()
+	last := reports[len(reports)-1]
+	equals(t, ReportApply, last.Event)
+	equals(t, ResultFailed, last.Result)
+	equals(t, "1.3", last.ToVersion)
+	equals(t, "not_found", last.ErrorClass)
+}
+
+func TestReportsAreSentInTheBackground(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	release.publishVersions("linux-amd64", "1.2", "1.3")
+	block := make(chan struct{})
+	reporting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer reporting.Close()
+
+	updater := release.updater("1.2", []byte("binary 1.2"))
+	updater.Reporter = &Reporter{URL: reporting.URL, InstallationID: "test", Timeout: 50 * time.Millisecond}
+	if _, err := updater.Check(); err != nil {
+		t.Fatal(err)
+	}
+	waitForReports()
+	queue := updater.getExecRelativeDir(updater.Dir + reportsPath)
+	equals(t, 1, len(queuedReports(queue)))
+
+	// checks don't wait for the server
+	updater.Reporter.Timeout = time.Hour
+	done := make(chan error)
+	go func() {
+		_, err := updater.Check()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the check not to wait for the report")
+	}
+	close(block)
+	waitForReports()
+	equals(t, 0, len(queuedReports(queue)))
+}
+
+func TestReportQueueIsBounded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	updater := &Updater{
+		CurrentVersion: "1.2",
+		Dir:            "update/",
+		Target:         filepath.Join(dir, "myapp"),
+		Reporter:       &Reporter{URL: "http://reports.invalid/", InstallationID: "test", MaxQueued: 3},
+	}
+	for i := 0; i < 5; i++ {
+		if err := updater.queueReport(Report{ToVersion: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queue := updater.getExecRelativeDir(updater.Dir + reportsPath)
+	queued := queuedReports(queue)
+	equals(t, 3, len(queued))
+	b, _ := ioutil.ReadFile(filepath.Join(queue, queued[0]))
+	if !strings.Contains(string(b), `"ToVersion":"2"`) {
+		t.Errorf("expected the oldest reports to be dropped, got %s", b)
+	}
+}
+
+// waitForReports waits until the queued reports are sent.
+func waitForReports() {
+	reportQueues.wg.Wait()
+}
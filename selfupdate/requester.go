@@ -1,9 +1,16 @@
 package selfupdate
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 //go:generate mockgen -destination=./mocks/requester.go -package=mocks -source=requester.go
@@ -14,22 +21,283 @@ type Requester interface {
 	Fetch(url string) (io.ReadCloser, error)
 }
 
+// ContextRequester is implemented by requesters that pass the context of
+// an update on to their requests, to cancel them or to propagate traces.
+type ContextRequester interface {
+	Requester
+	FetchContext(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// defaultUserAgent is sent when neither the requester nor the Updater
+// provide a more specific User-Agent.
+const defaultUserAgent = "go-selfupdate"
+
+// DefaultUserAgent returns the User-Agent an Updater sends when it creates
+// its own requester, e.g. "myapp/1.2 (linux-amd64) go-selfupdate".
+func DefaultUserAgent(cmdName, version, platform string) string {
+	return fmt.Sprintf("%s/%s (%s) %s", cmdName, version, platform, defaultUserAgent)
+}
+
+// StatusError is returned by HTTPRequester for responses with a status
+// code other than 200.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad http status from %s: %v", e.URL, e.Status)
+}
+
+// isNotFound reports whether err is a StatusError for a 404 response.
+func isNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
 // HTTPRequester is the normal requester that is used and does an HTTP
 // to the url location requested to retrieve the specified data.
+//
+// The zero value uses http.DefaultClient without any extra headers.
+// Use NewHTTPRequester to configure timeouts, authentication or TLS.
 type HTTPRequester struct {
+	Client    *http.Client // Optional client to use. Defaults to http.DefaultClient
+	Header    http.Header  // Optional headers added to every request
+	UserAgent string       // Optional User-Agent. Defaults to the UserAgent of the Updater, or "go-selfupdate"
+}
+
+// HTTPOption configures an HTTPRequester created by NewHTTPRequester.
+type HTTPOption func(*HTTPRequester) error
+
+// NewHTTPRequester returns an HTTPRequester configured with the given options.
+func NewHTTPRequester(opts ...HTTPOption) (*HTTPRequester, error) {
+	r := &HTTPRequester{Header: http.Header{}}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// WithHTTPClient uses a copy of client for all requests, so other options
+// don't modify client itself. Options changing the transport must be given
+// after this one.
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(r *HTTPRequester) error {
+		c := *client
+		r.Client = &c
+		return nil
+	}
+}
+
+// WithTimeout sets the overall timeout of a single request.
+func WithTimeout(timeout time.Duration) HTTPOption {
+	return func(r *HTTPRequester) error {
+		r.client().Timeout = timeout
+		return nil
+	}
+}
+
+// WithHeader adds a header that is sent with every request.
+func WithHeader(key, value string) HTTPOption {
+	return func(r *HTTPRequester) error {
+		r.Header.Add(key, value)
+		return nil
+	}
+}
+
+// WithUserAgent overrides the User-Agent header.
+func WithUserAgent(userAgent string) HTTPOption {
+	return func(r *HTTPRequester) error {
+		r.UserAgent = userAgent
+		return nil
+	}
+}
+
+// WithBearerToken authenticates every request with the given bearer token.
+func WithBearerToken(token string) HTTPOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithBasicAuth authenticates every request with HTTP basic authentication.
+func WithBasicAuth(username, password string) HTTPOption {
+	return func(r *HTTPRequester) error {
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(username, password)
+		r.Header.Set("Authorization", req.Header.Get("Authorization"))
+		return nil
+	}
+}
+
+// WithProxy routes all requests through the proxy returned by proxy.
+// Use http.ProxyURL to always use the same proxy.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) HTTPOption {
+	return func(r *HTTPRequester) error {
+		t, err := r.transport()
+		if err != nil {
+			return err
+		}
+		t.Proxy = proxy
+		return nil
+	}
+}
+
+// WithRootCAs verifies servers against pool instead of the system roots.
+func WithRootCAs(pool *x509.CertPool) HTTPOption {
+	return func(r *HTTPRequester) error {
+		t, err := r.transport()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+// WithRootCAFile verifies servers against the PEM encoded certificates in path.
+func WithRootCAFile(path string) HTTPOption {
+	return func(r *HTTPRequester) error {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", path)
+		}
+		return WithRootCAs(pool)(r)
+	}
+}
+
+// WithClientCertificate presents cert to servers requesting mutual TLS.
+func WithClientCertificate(cert tls.Certificate) HTTPOption {
+	return func(r *HTTPRequester) error {
+		t, err := r.transport()
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig.Certificates = append(t.TLSClientConfig.Certificates, cert)
+		return nil
+	}
+}
+
+// WithClientCertificateFile loads a PEM encoded certificate and key pair
+// for mutual TLS.
+func WithClientCertificateFile(certFile, keyFile string) HTTPOption {
+	return func(r *HTTPRequester) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		return WithClientCertificate(cert)(r)
+	}
+}
+
+// client returns the configured client, replacing a nil client by a
+// private copy of http.DefaultClient so options never modify the default.
+func (httpRequester *HTTPRequester) client() *http.Client {
+	if httpRequester.Client == nil {
+		c := *http.DefaultClient
+		httpRequester.Client = &c
+	}
+	return httpRequester.Client
+}
+
+// transport replaces the transport of the client, or the default
+// transport, by a private clone and returns it, so options never modify a
+// transport shared with other clients.
+func (httpRequester *HTTPRequester) transport() (*http.Transport, error) {
+	c := httpRequester.client()
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http client transport is not an *http.Transport")
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	c.Transport = t
+	return t, nil
 }
 
 // Fetch will return an HTTP request to the specified url and return
 // the body of the result. An error will occur for a non 200 status code.
 func (httpRequester *HTTPRequester) Fetch(url string) (io.ReadCloser, error) {
-	resp, err := http.Get(url)
+	return httpRequester.FetchContext(context.Background(), url)
+}
+
+// FetchContext is like Fetch but sends the request with ctx.
+func (httpRequester *HTTPRequester) FetchContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpRequester.do(req)
+}
+
+// contentLength sends a HEAD request for url and returns the announced size
+// of the body, -1 if the server didn't announce it.
+func (httpRequester *HTTPRequester) contentLength(url string) (int64, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := httpRequester.send(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.ContentLength, nil
+}
+
+// do sends req with the configured headers and returns the body of a 200
+// response.
+func (httpRequester *HTTPRequester) do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := httpRequester.send(req)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad http status from %s: %v", url, resp.Status)
+		resp.Body.Close()
+		return nil, &StatusError{URL: req.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	return resp.Body, nil
 }
+
+// send sends req with the configured headers and returns the response
+// regardless of its status code.
+func (httpRequester *HTTPRequester) send(req *http.Request) (*http.Response, error) {
+	for key, values := range httpRequester.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	userAgent := httpRequester.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	injectTrace(req.Context(), req)
+
+	client := httpRequester.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = countDownload(req.Context(), resp.Body)
+	return resp, nil
+}
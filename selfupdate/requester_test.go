@@ -0,0 +1,195 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPRequesterSendsHeadersAndAuth(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPRequester(
+		WithTimeout(time.Second),
+		WithBearerToken("secret"),
+		WithHeader("X-Channel", "beta"),
+		WithUserAgent(DefaultUserAgent("myapp", "1.2", "linux-amd64")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.Fetch(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+
+	equals(t, "ok", string(b))
+	equals(t, "Bearer secret", got.Get("Authorization"))
+	equals(t, "beta", got.Get("X-Channel"))
+	equals(t, "myapp/1.2 (linux-amd64) go-selfupdate", got.Get("User-Agent"))
+	equals(t, time.Second, r.Client.Timeout)
+	if http.DefaultClient.Timeout != 0 {
+		t.Error("options must not modify http.DefaultClient")
+	}
+}
+
+func TestHTTPRequesterCopiesClient(t *testing.T) {
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+	r, err := NewHTTPRequester(
+		WithHTTPClient(client),
+		WithTimeout(time.Second),
+		WithRootCAs(x509.NewCertPool()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, time.Duration(0), client.Timeout)
+	equals(t, true, client.Transport == transport)
+	if transport.TLSClientConfig != nil && transport.TLSClientConfig.RootCAs != nil {
+		t.Error("options must not modify the transport of the client")
+	}
+	equals(t, time.Second, r.Client.Timeout)
+	if r.Client.Transport.(*http.Transport).TLSClientConfig.RootCAs == nil {
+		t.Error("expected the root CAs on the copy of the client")
+	}
+
+	if _, err := NewHTTPRequester(WithHTTPClient(http.DefaultClient), WithProxy(nil), WithTimeout(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if http.DefaultClient.Timeout != 0 || http.DefaultClient.Transport != nil {
+		t.Error("options must not modify http.DefaultClient")
+	}
+}
+
+func TestHTTPRequesterBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPRequester(WithBasicAuth("user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.Fetch(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	if _, err := (&HTTPRequester{}).Fetch(srv.URL); err == nil {
+		t.Error("expected an error for a non 200 status code")
+	}
+}
+
+func TestHTTPRequesterMutualTLS(t *testing.T) {
+	cert := generateTestCertificate(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	if _, err := (&HTTPRequester{}).Fetch(srv.URL); err == nil {
+		t.Error("expected an error for an unknown server certificate")
+	}
+
+	r, err := NewHTTPRequester(WithRootCAs(roots), WithClientCertificate(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.Fetch(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+	equals(t, "selfupdate-client", string(b))
+}
+
+func TestUpdaterUserAgentOfConfiguredRequester(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.UserAgent())
+	}))
+	defer srv.Close()
+
+	requester, err := NewHTTPRequester(WithBearerToken("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Updater{CmdName: "myapp", CurrentVersion: "1.2", Platform: "linux-amd64", Requester: requester}
+	r, err := u.fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	requester.UserAgent = "custom"
+	if r, err = u.fetch(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	equals(t, "myapp/1.2 (linux-amd64) go-selfupdate custom", strings.Join(got, " "))
+	equals(t, "custom", requester.UserAgent)
+}
+
+func TestUpdaterDefaultUserAgent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.UserAgent()
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	updater := createUpdater(nil)
+	updater.ApiURL = srv.URL + "/"
+	if _, err := updater.GetNextVersion(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "myapp/1.2 ("+defaultPlatform+") go-selfupdate", got)
+}
+
+func generateTestCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "selfupdate-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
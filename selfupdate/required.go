@@ -0,0 +1,56 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+const requiredPath = "required.json"
+
+// UpdateRequired reports whether the last check found an update that must be
+// installed, because it is Mandatory or CurrentVersion is older than its
+// MinimumVersion, and returns its manifest. It doesn't check for updates.
+//
+// While an update is required, BackgroundRun checks on every call regardless
+// of CheckTime, so apps can block usage until the update is applied.
+func (u *Updater) UpdateRequired() (Info, bool) {
+	b, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + requiredPath))
+	if err != nil {
+		return Info{}, false
+	}
+	info := Info{}
+	if err := json.Unmarshal(b, &info); err != nil || !isRequired(info, u.CurrentVersion) {
+		return Info{}, false
+	}
+	// an older requirement is fulfilled once the update is installed
+	if compareVersions(u.CurrentVersion, info.Version) > 0 {
+		return Info{}, false
+	}
+	return info, true
+}
+
+// isRequired reports whether info must be installed by a client running
+// version current.
+func isRequired(info Info, current string) bool {
+	if info.Version == "" || info.Version == current {
+		return false
+	}
+	return info.Mandatory || (info.MinimumVersion != "" && compareVersions(current, info.MinimumVersion) < 0)
+}
+
+// recordRequired remembers whether the manifest found by a check must be
+// installed.
+func (u *Updater) recordRequired(info Info) {
+	path := u.getExecRelativeDir(u.Dir + requiredPath)
+	// a pin holds the client even at versions it would have to leave
+	if !isRequired(info, u.CurrentVersion) || !u.pinAllows(info.Version) {
+		_ = os.Remove(path)
+		return
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(path, b, 0644)
+}
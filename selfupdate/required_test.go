@@ -0,0 +1,72 @@
+package selfupdate
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/silthus/go-selfupdate/selfupdate/mocks"
+)
+
+func TestUpdaterMinimumVersionBypassesCheckTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mr := mocks.NewMockRequester(ctrl)
+	sha := sha256.Sum256([]byte("Test"))
+	required, _ := json.Marshal(Info{Version: "1.4", Sha256: sha[:], MinimumVersion: "1.3", Size: 4, PatchSizes: map[string]int64{"1.1": 4}})
+	optional, _ := json.Marshal(Info{Version: "1.4", Sha256: sha[:], MinimumVersion: "1.1", Size: 4, PatchSizes: map[string]int64{"1.1": 4}})
+	gomock.InOrder(
+		mr.EXPECT().Fetch(fmt.Sprintf("http://api.updates.yourdomain.com/myapp/%v.json", defaultPlatform)).Return(newTestReaderCloser(string(required)), nil),
+		mr.EXPECT().Fetch(fmt.Sprintf("http://api.updates.yourdomain.com/myapp/%v.json", defaultPlatform)).Return(newTestReaderCloser(string(optional)), nil),
+	)
+
+	updater := createUpdater(mr)
+	updater.Dir = "update-required/"
+	updater.CheckTime = 24
+	os.MkdirAll(updater.getExecRelativeDir(updater.Dir), 0777)
+	defer os.RemoveAll(updater.getExecRelativeDir(updater.Dir))
+	updater.SetUpdateTime()
+	if updater.WantUpdate() {
+		t.Fatal("expected no update before the next check time")
+	}
+
+	result, err := updater.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, true, result.Required)
+	info, ok := updater.UpdateRequired()
+	equals(t, true, ok)
+	equals(t, "1.4", info.Version)
+	equals(t, true, updater.WantUpdate())
+
+	if result, err = updater.Check(); err != nil {
+		t.Fatal(err)
+	}
+	equals(t, false, result.Required)
+	_, ok = updater.UpdateRequired()
+	equals(t, false, ok)
+	equals(t, false, updater.WantUpdate())
+}
+
+func TestIsRequired(t *testing.T) {
+	for _, test := range []struct {
+		info    Info
+		current string
+		want    bool
+	}{
+		{Info{Version: "1.4"}, "1.2", false},
+		{Info{Version: "1.4", Mandatory: true}, "1.2", true},
+		{Info{Version: "1.4", Mandatory: true}, "1.4", false},
+		{Info{Version: "1.4", MinimumVersion: "1.3"}, "1.2", true},
+		{Info{Version: "1.4", MinimumVersion: "1.3"}, "1.3", false},
+		{Info{MinimumVersion: "1.3"}, "1.2", false},
+	} {
+		if got := isRequired(test.info, test.current); got != test.want {
+			t.Errorf("isRequired(%#v, %q) = %v; want %v", test.info, test.current, got, test.want)
+		}
+	}
+}
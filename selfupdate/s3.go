@@ -0,0 +1,342 @@
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region  = "us-east-1"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	awsTimeFormat    = "20060102T150405Z"
+)
+
+// AWSCredentials are the keys used to sign requests to S3.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional token of temporary credentials
+}
+
+// AWSCredentialsProvider returns the credentials for the next request.
+type AWSCredentialsProvider interface {
+	AWSCredentials() (AWSCredentials, error)
+}
+
+// AWSCredentials returns the static credentials c.
+func (c AWSCredentials) AWSCredentials() (AWSCredentials, error) {
+	return c, nil
+}
+
+// EnvAWSCredentials reads credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type EnvAWSCredentials struct{}
+
+func (EnvAWSCredentials) AWSCredentials() (AWSCredentials, error) {
+	c := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY not set")
+	}
+	return c, nil
+}
+
+// ProfileAWSCredentials reads credentials of a profile from a shared
+// credentials file like ~/.aws/credentials.
+type ProfileAWSCredentials struct {
+	File    string // Optional path of the file. Defaults to $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+	Profile string // Optional profile. Defaults to $AWS_PROFILE or default
+}
+
+func (p ProfileAWSCredentials) AWSCredentials() (AWSCredentials, error) {
+	file := p.File
+	if file == "" {
+		file = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return AWSCredentials{}, err
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := p.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	defer f.Close()
+	var c AWSCredentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimPrefix(strings.TrimSpace(line[1:len(line)-1]), "profile ")
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if section != profile || len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			c.AccessKeyID = value
+		case "aws_secret_access_key":
+			c.SecretAccessKey = value
+		case "aws_session_token":
+			c.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AWSCredentials{}, err
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return AWSCredentials{}, fmt.Errorf("no credentials for profile %s in %s", profile, file)
+	}
+	return c, nil
+}
+
+// defaultAWSCredentials tries the environment before the shared credentials file.
+type defaultAWSCredentials struct{}
+
+func (defaultAWSCredentials) AWSCredentials() (AWSCredentials, error) {
+	if c, err := (EnvAWSCredentials{}).AWSCredentials(); err == nil {
+		return c, nil
+	}
+	return ProfileAWSCredentials{}.AWSCredentials()
+}
+
+// S3Requester is a Requester fetching objects from private buckets of S3 or
+// S3 compatible storage like MinIO. Every request is signed with AWS
+// Signature Version 4.
+//
+// URLs are either http(s) URLs of objects, which are signed as they are, or
+// s3://bucket/key URLs, which are resolved against Endpoint. Use s3:// URLs
+// as ApiURL, BinURL and DiffURL to switch between path-style and
+// virtual-hosted addressing with PathStyle.
+//
+// Example:
+//
+//  updater := &selfupdate.Updater{
+//  	CurrentVersion: version,
+//  	ApiURL:         "s3://updates/",
+//  	BinURL:         "s3://updates/",
+//  	DiffURL:        "s3://updates/",
+//  	Dir:            "update/",
+//  	CmdName:        "myapp",
+//  	Requester: &selfupdate.S3Requester{
+//  		Region:    "eu-central-1",
+//  		Endpoint:  "https://minio.example.com",
+//  		PathStyle: true,
+//  	},
+//  }
+type S3Requester struct {
+	Region      string                 // Optional region of the bucket. Defaults to us-east-1
+	Endpoint    string                 // Optional endpoint for s3:// URLs. Defaults to https://s3.<region>.amazonaws.com
+	PathStyle   bool                   // Optional parameter to address buckets of s3:// URLs in the path instead of the host name
+	Credentials AWSCredentialsProvider // Optional credentials. Defaults to the environment, then the shared credentials file
+	Requester   *HTTPRequester         // Optional requester to configure timeouts, proxies or TLS
+}
+
+// Fetch signs and sends a GET request for the object at rawURL.
+func (s *S3Requester) Fetch(rawURL string) (io.ReadCloser, error) {
+	return s.FetchContext(context.Background(), rawURL)
+}
+
+// FetchContext is like Fetch but sends the request with ctx.
+func (s *S3Requester) FetchContext(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := s.resolve(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s.credentials().AWSCredentials()
+	if err != nil {
+		return nil, err
+	}
+	// the configured headers are signed too, so they aren't added again
+	requester := &HTTPRequester{}
+	if s.Requester != nil {
+		c := *s.Requester
+		for key, values := range c.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		c.Header = nil
+		requester = &c
+	}
+	signAWSV4(req, creds, s.region(), "s3", time.Now())
+	return requester.do(req)
+}
+
+// resolve translates s3://bucket/key URLs to the endpoint.
+func (s *S3Requester) resolve(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "s3" {
+		return rawURL, nil
+	}
+	endpoint, err := url.Parse(s.endpoint())
+	if err != nil {
+		return "", err
+	}
+	bucket := u.Host
+	if s.PathStyle {
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + bucket + u.Path
+		endpoint.RawPath = strings.TrimSuffix(endpoint.EscapedPath(), "/") + "/" + url.PathEscape(bucket) + u.EscapedPath()
+	} else {
+		endpoint.Host = bucket + "." + endpoint.Host
+		endpoint.Path = u.Path
+		endpoint.RawPath = u.RawPath
+	}
+	endpoint.RawQuery = u.RawQuery
+	return endpoint.String(), nil
+}
+
+func (s *S3Requester) region() string {
+	if s.Region == "" {
+		return defaultS3Region
+	}
+	return s.Region
+}
+
+func (s *S3Requester) endpoint() string {
+	if s.Endpoint == "" {
+		return "https://s3." + s.region() + ".amazonaws.com"
+	}
+	return s.Endpoint
+}
+
+func (s *S3Requester) credentials() AWSCredentialsProvider {
+	if s.Credentials == nil {
+		return defaultAWSCredentials{}
+	}
+	return s.Credentials
+}
+
+// signAWSV4 adds the headers and the Authorization of AWS Signature Version 4
+// for an empty payload to req. All headers set so far are signed.
+func signAWSV4(req *http.Request, creds AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(awsTimeFormat)
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if key == "authorization" || key == "user-agent" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[key] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode percent-encodes every byte of s except the unreserved
+// characters of RFC 3986, and except the slash if encodeSlash is false.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
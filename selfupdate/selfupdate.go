@@ -27,7 +27,7 @@ package selfupdate
 
 import (
 	"bytes"
-	"compress/gzip"
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -38,25 +38,22 @@ import (
 	"io/ioutil"
 	"log"
 	"math/rand"
-	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
 
 	"github.com/kr/binarydist"
-	"gopkg.in/inconshreveable/go-update.v0"
 )
 
 const (
 	upcktimePath    = "cktime"
+	installedPath   = "installed.json"
 	defaultPlatform = runtime.GOOS + "-" + runtime.GOARCH
 )
 
 var ErrHashMismatch = errors.New("new file hash mismatch after patch")
 var ErrSignatureMismatch = errors.New("new file signature mismatch after patch")
-var up = update.New()
-var defaultHTTPRequester = HTTPRequester{}
 
 // Updater is the configuration and runtime data for doing an update.
 //
@@ -85,10 +82,34 @@ type Updater struct {
 	ForceCheck     bool           // Check for update regardless of cktime timestamp
 	CheckTime      int            // Time in hours before next check
 	RandomizeTime  int            // Time in hours to randomize with CheckTime
-	Requester      Requester      //Optional parameter to override existing http request handler
+	Requester      Requester      //Optional parameter to override existing http request handler. Defaults to an HTTPRequester sending DefaultUserAgent
 	PublicKey      *rsa.PublicKey // Optional parameter to check signature in the update. If a key is set any binary must be checked with supplied Signature hash of API
 	Target         string         // Optional parameter to specify binary to update. Set to current executable if not specified
 	Platform       string         // Optional parameter to specify platform. Defaults to ${runtime.GOOS}-${runtime.GOARCH}
+	Variants       bool           // Optional parameter to prefer builds for the CPU level and libc of the machine, like linux-amd64-v3 or linux-arm-v7-musl, over the platform
+	ApiMirrors     []Mirror       // Optional parameter to fall back to other URLs serving the json files
+	BinMirrors     []Mirror       // Optional parameter to fall back to other URLs serving full binaries
+	DiffMirrors    []Mirror       // Optional parameter to fall back to other URLs serving diffs
+	Source         Source         // Optional parameter to fetch updates from somewhere else than ApiURL, BinURL and DiffURL
+	Channel        string         // Optional parameter to select a release channel on sources supporting them, or one assigned with AssignChannel in the index of ApiURL
+	Pin            string         // Optional version or range like 1.4.2, 1.4.x or ">=1.4, <1.5" to hold the client at, even if that means going down a version
+	PolicyFile     string         // Optional path of the administrator Policy file. Defaults to /etc/go-selfupdate/${CmdName}.json, or %ProgramData%\go-selfupdate\${CmdName}.json on windows
+	LockMode       LockMode       // Optional parameter to choose what happens if another process is updating. Defaults to LockSkip
+	LockTimeout    time.Duration  // Optional maximum time to wait for another process with LockWait. Defaults to no limit
+	DryRun         bool           // Optional parameter to download and verify updates without installing them
+	DeferApply     bool           // Optional parameter to stage verified updates in Dir until ApplyPending is called
+	OnUpdateFound  ConsentFunc    // Optional callback to approve, defer, skip or abort an update when it is found
+	BeforeDownload ConsentFunc    // Optional callback to approve, defer, skip or abort an update before it is downloaded
+	BeforeInstall  ConsentFunc    // Optional callback to approve, defer, skip or abort an update before it is installed
+
+	SmokeTestArgs    []string      // Optional arguments to run a new binary with before installing it, e.g. --version. The binary must exit successfully
+	SmokeTestTimeout time.Duration // Optional maximum run time of the smoke test. Defaults to 10 seconds
+	SmokeTestVersion bool          // Optional parameter to require the smoke test to print the version of the update
+	Metrics          *Metrics      // Optional collector of the update activity
+	Tracer           Tracer        // Optional recorder of spans for the phases of updates, see the selfupdate/otel package
+	Reporter         *Reporter     // Optional endpoint to report the outcome of checks and updates to
+
+	policy *Policy // policy applied to this copy by applyPolicy
 }
 
 func (u *Updater) getPlatform() string {
@@ -117,26 +138,56 @@ func (u *Updater) getExecRelativeDir(dir string) string {
 
 // BackgroundRun starts the update check and apply cycle.
 // A new applied version is returned.
-func (u *Updater) BackgroundRun() (Info, error) {
+//
+// Only one process checks and updates at a time, see LockMode.
+func (u *Updater) BackgroundRun() (info Info, err error) {
+	u, err = u.applyPolicy()
+	if err == ErrUpdatesDisabled {
+		return Info{}, nil
+	} else if err != nil {
+		return Info{}, err
+	}
+	ctx, span := u.startSpan(context.Background(), "selfupdate.BackgroundRun")
+	defer func() { span.End(err) }()
 	if err := os.MkdirAll(u.getExecRelativeDir(u.Dir), 0777); err != nil {
 		// fail
 		return Info{}, err
 	}
+	release, ok, err := u.lock()
+	if err != nil || !ok {
+		return Info{}, err
+	}
+	defer release()
+
 	if u.WantUpdate() {
-		if err := up.CanUpdate(); err != nil {
-			// fail
-			return Info{}, err
-		}
+		if !u.DryRun {
+			if err := canInstall(u.getTargetAbsoluteDir()); err != nil {
+				// fail
+				return Info{}, err
+			}
 
-		u.SetUpdateTime()
-		return u.Update()
+			u.SetUpdateTime()
+		}
+		return u.update(ctx)
 	}
 	return Info{}, nil
 }
 
 // WantUpdate returns boolean designating if an update is desired
+//
+// A required update, see UpdateRequired, is always desired.
 func (u *Updater) WantUpdate() bool {
-	if u.CurrentVersion == "dev" || (!u.ForceCheck && u.NextUpdate().After(time.Now())) {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return false
+	}
+	if u.CurrentVersion == "dev" {
+		return false
+	}
+	if _, required := u.UpdateRequired(); required {
+		return true
+	}
+	if !u.ForceCheck && u.NextUpdate().After(time.Now()) {
 		return false
 	}
 
@@ -153,6 +204,10 @@ func (u *Updater) NextUpdate() time.Time {
 
 // SetUpdateTime writes the next update time to the state file
 func (u *Updater) SetUpdateTime() bool {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return false
+	}
 	path := u.getExecRelativeDir(u.Dir + upcktimePath)
 	wait := time.Duration(u.CheckTime) * time.Hour
 	// Add 1 to random time since max is not included
@@ -167,8 +222,36 @@ func (u *Updater) ClearUpdateState() {
 	_ = os.Remove(path)
 }
 
+// InstalledInfo returns the manifest of the version last installed by the
+// Updater, e.g. to show its release notes after a restart. An empty Info is
+// returned if nothing was installed yet.
+func (u *Updater) InstalledInfo() (Info, error) {
+	b, err := ioutil.ReadFile(u.getExecRelativeDir(u.Dir + installedPath))
+	if os.IsNotExist(err) {
+		return Info{}, nil
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{}
+	err = json.Unmarshal(b, &info)
+	return info, err
+}
+
+func (u *Updater) writeInstalledInfo(info Info) {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(u.getExecRelativeDir(u.Dir+installedPath), b, 0644)
+}
+
 // UpdateAvailable checks if update is available and returns version
 func (u *Updater) UpdateAvailable() (string, error) {
+	u, err := u.applyPolicy()
+	if err != nil {
+		return "", err
+	}
 	path := u.getTargetAbsoluteDir()
 	old, err := os.Open(path)
 	if err != nil {
@@ -176,34 +259,86 @@ func (u *Updater) UpdateAvailable() (string, error) {
 	}
 	defer old.Close()
 
-	info, err := u.fetchInfo()
+	info, err := u.nextInfo(context.Background())
 	if err != nil {
 		return "", err
 	}
-	if info.Version == u.CurrentVersion {
+	if info.Version == u.CurrentVersion || u.isSkipped(info) {
 		return "", nil
 	} else {
 		return info.Version, nil
 	}
 }
 
+// GetNextVersion returns the version Update would install, which is empty
+// if it is skipped or no version matches Pin but the current one.
 func (u *Updater) GetNextVersion() (Info, error) {
-	return u.fetchInfo()
+	u, err := u.applyPolicy()
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := u.nextInfo(context.Background())
+	if err != nil {
+		return Info{}, err
+	}
+	if info.Version != "" && u.isSkipped(info) {
+		return Info{}, nil
+	}
+	return info, nil
 }
 
 // Update initiates the self update process
+//
+// Only one process updates at a time, see LockMode. With DryRun the update
+// is downloaded and verified but not installed, and the version that would
+// have been installed is returned. With DeferApply the update is staged
+// until ApplyPending installs it.
 func (u *Updater) Update() (Info, error) {
-	path := u.getTargetAbsoluteDir()
-	old, err := os.Open(path)
+	u, err := u.applyPolicy()
 	if err != nil {
 		return Info{}, err
 	}
-	defer old.Close()
+	release, ok, err := u.lock()
+	if err != nil || !ok {
+		return Info{}, err
+	}
+	defer release()
+
+	return u.update(context.Background())
+}
 
-	info, err := u.fetchInfo()
+func (u *Updater) update(ctx context.Context) (info Info, err error) {
+	var target Info
+	start := time.Now()
+	ctx, span := u.startUpdateSpan(ctx, "selfupdate.Update")
+	defer func() { u.endUpdate(span, start, target, info, err) }()
+	target, err = u.nextInfo(ctx)
 	if err != nil {
 		return Info{}, err
 	}
+	return u.apply(ctx, target, false)
+}
+
+// nextInfo fetches the info of the version to update to: the latest one,
+// or the newest one matching Pin.
+func (u *Updater) nextInfo(ctx context.Context) (Info, error) {
+	info, err := u.fetchInfo(ctx)
+	if err != nil || u.Pin == "" {
+		return info, err
+	}
+	return u.pinnedInfo(info)
+}
+
+// apply downloads and installs version info, unless it is the current
+// version. Versions asked for explicitly are installed even if skipped.
+func (u *Updater) apply(ctx context.Context, info Info, explicit bool) (Info, error) {
+	path := u.getTargetAbsoluteDir()
+	old, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer old.Close()
+
 	if info.Version == "" {
 		// No Update available
 		return Info{}, nil
@@ -216,17 +351,30 @@ func (u *Updater) Update() (Info, error) {
 			return Info{}, fmt.Errorf("update: configured with public key but version info had no signature")
 		}
 	}
-	bin, err := u.fetchAndVerifyPatch(info, old)
+	if !explicit && u.isSkipped(info) {
+		return Info{}, nil
+	}
+	if ok, err := u.consent(u.OnUpdateFound, info); !ok {
+		return Info{}, err
+	}
+	if pending, ok := u.PendingUpdate(); ok && u.DeferApply && pending.Version == info.Version {
+		// already staged
+		return info, nil
+	}
+	if ok, err := u.consent(u.BeforeDownload, info); !ok {
+		return Info{}, err
+	}
+	bin, err := u.fetchAndVerifyPatch(ctx, info, old)
 	if err != nil {
+		spanFromContext(ctx).SetAttributes(attrFallback.String(fallbackReason(err)))
 		if err == ErrHashMismatch {
 			log.Println("update: hash mismatch from patched binary")
-		} else {
-			if u.DiffURL != "" {
-				log.Println("update: error patching binary,", err)
-			}
+			u.recordPatchFallback()
+		} else if err != ErrNoPatch {
+			log.Println("update: error patching binary,", err)
 		}
 
-		bin, err = u.fetchAndVerifyFullBin(info)
+		bin, err = u.fetchAndVerifyFullBin(ctx, info)
 		if err != nil {
 			if err == ErrHashMismatch {
 				log.Println("update: hash mismatch from full binary")
@@ -237,101 +385,232 @@ func (u *Updater) Update() (Info, error) {
 		}
 	}
 
+	if u.DryRun {
+		return info, nil
+	}
+	if u.DeferApply {
+		if err := u.stage(bin, info, explicit || u.Pin != ""); err != nil {
+			return Info{}, err
+		}
+		return info, nil
+	}
+	if ok, err := u.consent(u.BeforeInstall, info); !ok {
+		return Info{}, err
+	}
+
 	// close the old binary before installing because on windows
 	// it can't be renamed if a handle to the file is still open
 	_ = old.Close()
 
-	err, errRecover := up.FromStream(bytes.NewBuffer(bin))
-	if errRecover != nil {
-		return Info{}, fmt.Errorf("update and recovery errors: %q %q", err, errRecover)
-	}
-	if err != nil {
+	if err := u.install(ctx, bin, info); err != nil {
 		return Info{}, err
 	}
 	return info, nil
 }
 
-func (u *Updater) fetchInfo() (Info, error) {
-	r, err := u.fetch(u.ApiURL + url.QueryEscape(u.CmdName) + "/" + url.QueryEscape(u.getPlatform()) + ".json")
-	if err != nil {
-		return Info{}, err
+// install replaces the target by the verified binary bin of version info.
+func (u *Updater) install(ctx context.Context, bin []byte, info Info) (err error) {
+	_, span := u.startSpan(ctx, "selfupdate.Install", attrVersion.String(info.Version))
+	defer func() { span.End(err) }()
+	if err := installFile(u.getTargetAbsoluteDir(), bin, u.smokeTest(info)); err != nil {
+		return err
 	}
-	defer r.Close()
-	info := Info{}
-	err = json.NewDecoder(r).Decode(&info)
+	u.writeInstalledInfo(info)
+	return nil
+}
+
+func (u *Updater) fetchInfo(ctx context.Context) (Info, error) {
+	info, _, err := u.fetchInfoFrom(ctx)
+	return info, err
+}
+
+// fetchInfoFrom fetches the manifest and returns the name of the source it
+// was read from.
+func (u *Updater) fetchInfoFrom(ctx context.Context) (info Info, from string, err error) {
+	start := time.Now()
+	ctx, span := u.startSpan(ctx, "selfupdate.FetchManifest")
+	defer func() {
+		span.SetAttributes(attrVersion.String(info.Version), attrPlatform.String(info.Platform), attrSource.String(from))
+		span.End(err)
+		u.reportCheck(start, info, err)
+	}()
+	u.recordCheck()
+	ctx = u.withDownload(ctx, DownloadManifest)
+	platforms := u.platforms()
+	err = u.tryMirrors(u.ApiURL, u.ApiMirrors, func(s Source) error {
+		var err error
+		if indexed, ok := unwrapSource(s).(IndexSource); ok && u.Channel != "" {
+			info, err = u.channelInfo(ctx, indexed)
+		} else {
+			for i, platform := range platforms {
+				info, err = s.FetchInfo(ctx, u.CmdName, platform, u.Channel)
+				// variants that aren't published are skipped
+				if i < len(platforms)-1 && (isMissing(err) || err == nil && info.Version == "") {
+					continue
+				}
+				if err == nil && info.Version != "" {
+					info.Platform = platform
+				}
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if info.Version != "" && len(info.Sha256) != sha256.Size {
+			return fmt.Errorf("bad cmd hash in info. Expected %v got %v", sha256.Size, len(info.Sha256))
+		}
+		from = sourceName(s)
+		return nil
+	})
 	if err != nil {
-		return Info{}, err
+		return Info{}, "", err
 	}
-	if info.Version != "" && len(info.Sha256) != sha256.Size {
-		return Info{}, fmt.Errorf("bad cmd hash in info. Expected %v got %v", sha256.Size, len(info.Sha256))
-	}
-	return info, nil
+	u.recordRequired(info)
+	return info, from, nil
 }
 
-func (u *Updater) fetchAndVerifyPatch(info Info, old io.Reader) ([]byte, error) {
-	bin, err := u.fetchAndApplyPatch(info, old)
+func (u *Updater) fetchAndVerifyPatch(ctx context.Context, info Info, old io.Reader) ([]byte, error) {
+	oldBin, err := ioutil.ReadAll(old)
 	if err != nil {
 		return nil, err
 	}
-	if !verifySha(bin, info.Sha256) {
-		return nil, ErrHashMismatch
-	}
-	if !verifySignature(u.PublicKey, bin, info.Signature) {
-		return nil, ErrSignatureMismatch
+	var bin []byte
+	ctx = u.withDownload(ctx, DownloadPatch)
+	err = u.tryMirrors(u.DiffURL, u.DiffMirrors, func(s Source) error {
+		var err error
+		bin, err = u.fetchAndApplyPatch(ctx, s, info, bytes.NewReader(oldBin))
+		if err != nil {
+			return err
+		}
+		return u.verifyContext(ctx, bin, info)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return bin, nil
 }
 
-func (u *Updater) fetchAndApplyPatch(info Info, old io.Reader) ([]byte, error) {
-	r, err := u.fetch(u.DiffURL + url.QueryEscape(u.CmdName) + "/" + url.QueryEscape(u.CurrentVersion) + "/" + url.QueryEscape(info.Version) + "/" + url.QueryEscape(u.getPlatform()))
+func (u *Updater) fetchAndApplyPatch(ctx context.Context, s Source, info Info, old io.Reader) ([]byte, error) {
+	patch, err := u.download(ctx, "selfupdate.DownloadPatch", info, func(ctx context.Context) (io.ReadCloser, error) {
+		return s.FetchPatch(ctx, u.CmdName, u.CurrentVersion, info.Version, u.platformFor(info))
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
+	_, span := u.startSpan(ctx, "selfupdate.ApplyPatch", attrVersion.String(info.Version))
 	var buf bytes.Buffer
-	err = binarydist.Patch(old, &buf, r)
+	err = binarydist.Patch(old, &buf, bytes.NewReader(patch))
+	span.End(err)
 	return buf.Bytes(), err
 }
 
-func (u *Updater) fetchAndVerifyFullBin(info Info) ([]byte, error) {
-	bin, err := u.fetchBin(info)
+func (u *Updater) fetchAndVerifyFullBin(ctx context.Context, info Info) ([]byte, error) {
+	var bin []byte
+	ctx = u.withDownload(ctx, DownloadFull)
+	err := u.tryMirrors(u.BinURL, u.BinMirrors, func(s Source) error {
+		var err error
+		bin, err = u.fetchBin(ctx, s, info)
+		if err != nil {
+			return err
+		}
+		return u.verifyContext(ctx, bin, info)
+	})
 	if err != nil {
 		return nil, err
 	}
-	verified := verifySha(bin, info.Sha256)
-	if !verified {
-		return nil, ErrHashMismatch
-	}
-	if !verifySignature(u.PublicKey, bin, info.Signature) {
-		return nil, ErrSignatureMismatch
-	}
 	return bin, nil
 }
 
-func (u *Updater) fetchBin(info Info) ([]byte, error) {
-	r, err := u.fetch(u.BinURL + url.QueryEscape(u.CmdName) + "/" + url.QueryEscape(info.Version) + "/" + url.QueryEscape(u.getPlatform()) + ".gz")
+func (u *Updater) fetchBin(ctx context.Context, s Source, info Info) ([]byte, error) {
+	return u.download(ctx, "selfupdate.DownloadFull", info, func(ctx context.Context) (io.ReadCloser, error) {
+		return s.FetchBin(ctx, u.CmdName, info.Version, u.platformFor(info))
+	})
+}
+
+// download reads the file opened by fetch in a span named name.
+func (u *Updater) download(ctx context.Context, name string, info Info, fetch func(ctx context.Context) (io.ReadCloser, error)) (b []byte, err error) {
+	ctx, span := u.startSpan(ctx, name, attrVersion.String(info.Version), attrPlatform.String(u.platformFor(info)))
+	defer func() {
+		span.SetAttributes(attrBytes.Int(len(b)))
+		span.End(err)
+	}()
+	r, err := fetch(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close()
 	buf := new(bytes.Buffer)
-	gz, err := gzip.NewReader(r)
-	if err != nil {
-		return nil, err
-	}
-	if _, err = io.Copy(buf, gz); err != nil {
+	if _, err = io.Copy(buf, r); err != nil {
 		return nil, err
 	}
 
 	return buf.Bytes(), nil
 }
 
-func (u *Updater) fetch(url string) (io.ReadCloser, error) {
-	if u.Requester == nil {
-		return defaultHTTPRequester.Fetch(url)
+// verifyContext is verify in a span.
+func (u *Updater) verifyContext(ctx context.Context, bin []byte, info Info) (err error) {
+	_, span := u.startSpan(ctx, "selfupdate.Verify", attrVersion.String(info.Version))
+	defer func() { span.End(err) }()
+	return u.verify(bin, info)
+}
+
+// verify checks bin against the hash and signature of the manifest and
+// checks that it is an executable for the platform.
+func (u *Updater) verify(bin []byte, info Info) error {
+	if !verifySha(bin, info.Sha256) {
+		return ErrHashMismatch
+	}
+	if !verifySignature(u.PublicKey, bin, info.Signature) {
+		u.recordSignatureFailure()
+		return ErrSignatureMismatch
 	}
+	return CheckPlatform(bytes.NewReader(bin), u.platformFor(info))
+}
 
-	readCloser, err := u.Requester.Fetch(url)
+// UserAgent returns the User-Agent sent by the default requester.
+func (u *Updater) UserAgent() string {
+	return DefaultUserAgent(u.CmdName, u.CurrentVersion, u.getPlatform())
+}
+
+// requester returns the Requester, or the default requester if it is nil.
+// HTTP requesters not setting a User-Agent send UserAgent.
+func (u *Updater) requester() Requester {
+	switch r := u.Requester.(type) {
+	case nil:
+		return u.withUserAgent(nil)
+	case *HTTPRequester:
+		return u.withUserAgent(r)
+	case *S3Requester:
+		c := *r
+		c.Requester = u.withUserAgent(r.Requester)
+		return &c
+	}
+	return u.Requester
+}
+
+// withUserAgent returns r, or a copy of it sending UserAgent if it doesn't
+// set a User-Agent. r may be nil.
+func (u *Updater) withUserAgent(r *HTTPRequester) *HTTPRequester {
+	if r == nil {
+		return &HTTPRequester{UserAgent: u.UserAgent()}
+	}
+	if r.UserAgent != "" {
+		return r
+	}
+	c := *r
+	c.UserAgent = u.UserAgent()
+	return &c
+}
+
+func (u *Updater) fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	var readCloser io.ReadCloser
+	var err error
+	if r, ok := u.requester().(ContextRequester); ok {
+		readCloser, err = r.FetchContext(ctx, url)
+	} else {
+		readCloser, err = u.Requester.Fetch(url)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -343,6 +622,18 @@ func (u *Updater) fetch(url string) (io.ReadCloser, error) {
 	return readCloser, nil
 }
 
+// contentLength returns the size of url announced for a HEAD request. ok is
+// false if the Requester can't send HEAD requests.
+func (u *Updater) contentLength(url string) (size int64, ok bool, err error) {
+	switch r := u.requester().(type) {
+	case *HTTPRequester:
+		size, err = r.contentLength(url)
+	default:
+		return 0, false, nil
+	}
+	return size, true, err
+}
+
 func readTime(path string) time.Time {
 	p, err := ioutil.ReadFile(path)
 	if os.IsNotExist(err) {
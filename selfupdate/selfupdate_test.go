@@ -2,13 +2,19 @@ package selfupdate
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +22,25 @@ import (
 	"github.com/silthus/go-selfupdate/selfupdate/mocks"
 )
 
+func TestMain(m *testing.M) {
+	// the policy of the machine running the tests must not change them
+	dir, err := ioutil.TempDir("", "selfupdate-policy")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	policyDir = dir
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(name, "SELFUPDATE_") || strings.Contains(name, "_SELFUPDATE_") {
+			os.Unsetenv(name)
+		}
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestUpdaterFetchMustReturnNonNilReaderCloser(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -223,3 +248,177 @@ func (trc *testReadCloser) Read(p []byte) (n int, err error) {
 func (trc *testReadCloser) Close() error {
 	return nil
 }
+
+func TestUpdaterFailsOverToMirrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mr := mocks.NewMockRequester(ctrl)
+	h := sha256.New()
+	h.Write([]byte("Test"))
+	c := Info{Version: "1.3", Sha256: h.Sum(nil)}
+	b, _ := json.Marshal(c)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("Test"))
+	w.Close()
+	var bad bytes.Buffer
+	w = gzip.NewWriter(&bad)
+	w.Write([]byte("Tampered"))
+	w.Close()
+
+	gomock.InOrder(
+		mr.EXPECT().Fetch(fmt.Sprintf("http://api.updates.yourdomain.com/myapp/%v.json", defaultPlatform)).Return(nil, fmt.Errorf("Bad status code on api: 503")),
+		mr.EXPECT().Fetch(fmt.Sprintf("http://api.mirror.yourdomain.com/myapp/%v.json", defaultPlatform)).Return(newTestReaderCloser(string(b)), nil),
+		mr.EXPECT().Fetch(fmt.Sprintf("http://bin.updates.yourdownmain.com/myapp/1.3/%v.gz", defaultPlatform)).Return(nil, fmt.Errorf("Bad status code on binary: 404")),
+		mr.EXPECT().Fetch(fmt.Sprintf("http://untrusted.mirror.com/myapp/1.3/%v.gz", defaultPlatform)).Return(newTestReaderCloser(bad.String()), nil),
+		mr.EXPECT().Fetch(fmt.Sprintf("http://bin.mirror.yourdomain.com/myapp/1.3/%v.gz", defaultPlatform)).Return(newTestReaderCloser(gz.String()), nil),
+		// failed URLs are tried last on the next update
+		mr.EXPECT().Fetch(fmt.Sprintf("http://bin.mirror.yourdomain.com/myapp/1.3/%v.gz", defaultPlatform)).Return(newTestReaderCloser(gz.String()), nil),
+	)
+
+	updater := createUpdater(mr)
+	updater.Dir = "update-mirrors/"
+	updater.ApiMirrors = []Mirror{{URL: "http://api.mirror.yourdomain.com/"}}
+	updater.BinMirrors = []Mirror{{URL: "http://untrusted.mirror.com/"}, {URL: "http://bin.mirror.yourdomain.com/"}}
+	os.MkdirAll(updater.getExecRelativeDir(updater.Dir), 0777)
+	defer os.RemoveAll(updater.getExecRelativeDir(updater.Dir))
+
+	info, err := updater.GetNextVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1.3", info.Version)
+	for i := 0; i < 2; i++ {
+		bin, err := updater.fetchAndVerifyFullBin(context.Background(), info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		equals(t, "Test", string(bin))
+	}
+
+	health := updater.MirrorHealth()
+	equals(t, 3, len(health))
+	equals(t, 1, health["http://untrusted.mirror.com/"].Failures)
+	equals(t, 1, health["http://api.updates.yourdomain.com/"].Failures)
+}
+
+func TestUpdaterMissingPatchKeepsMirrorsHealthy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mr := mocks.NewMockRequester(ctrl)
+	notFound := func(url string) (io.ReadCloser, error) {
+		return nil, &StatusError{URL: url, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	mr.EXPECT().Fetch(fmt.Sprintf("http://diff.updates.yourdomain.com/myapp/1.2/1.3/%v", defaultPlatform)).DoAndReturn(notFound)
+	mr.EXPECT().Fetch(fmt.Sprintf("http://diff.mirror.yourdomain.com/myapp/1.2/1.3/%v", defaultPlatform)).DoAndReturn(notFound)
+
+	updater := createUpdater(mr)
+	updater.Dir = "update-mirrors-patch/"
+	updater.DiffMirrors = []Mirror{{URL: "http://diff.mirror.yourdomain.com/"}}
+	os.MkdirAll(updater.getExecRelativeDir(updater.Dir), 0777)
+	defer os.RemoveAll(updater.getExecRelativeDir(updater.Dir))
+
+	_, err := updater.fetchAndVerifyPatch(context.Background(), Info{Version: "1.3"}, bytes.NewReader(nil))
+	if err != ErrNoPatch {
+		t.Errorf("expected ErrNoPatch, got %v", err)
+	}
+	equals(t, 0, len(updater.MirrorHealth()))
+}
+
+func TestUpdaterLockSkipsOrWaitsForOtherProcess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mr := mocks.NewMockRequester(ctrl)
+	mr.EXPECT().Fetch(gomock.Any()).Times(0)
+
+	holder := createUpdater(mr)
+	holder.Dir = "update-lock/"
+	defer os.RemoveAll(holder.getExecRelativeDir(holder.Dir))
+	release, ok, err := holder.lock()
+	if err != nil || !ok {
+		t.Fatalf("expected to acquire the lock, got %v %v", ok, err)
+	}
+
+	updater := createUpdater(mr)
+	updater.Dir = holder.Dir
+	updater.ForceCheck = true
+	if info, err := updater.BackgroundRun(); err != nil || info.Version != "" {
+		t.Errorf("expected the update to be skipped, got %#v %v", info, err)
+	}
+
+	updater.LockMode = LockWait
+	updater.LockTimeout = 200 * time.Millisecond
+	if _, err := updater.Update(); err != ErrLockTimeout {
+		t.Errorf("expected ErrLockTimeout, got %v", err)
+	}
+
+	release()
+	release, ok, err = updater.lock()
+	if err != nil || !ok {
+		t.Fatalf("expected to acquire the released lock, got %v %v", ok, err)
+	}
+	release()
+}
+
+func TestUpdatersInstallTheirTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := &FSSource{FS: os.DirFS(filepath.Join(dir, "public"))}
+	var updaters []*Updater
+	for _, cmdName := range []string{"tool", "agent"} {
+		genDir := filepath.Join(dir, "public", cmdName)
+		os.MkdirAll(genDir, 0755)
+		for _, version := range []string{"1.2", "1.3"} {
+			path := filepath.Join(dir, cmdName+"-"+version)
+			ioutil.WriteFile(path, []byte(cmdName+" "+version), 0755)
+			CreateUpdate(Info{Version: version}, path, "linux-amd64", genDir, nil)
+		}
+		updaters = append(updaters, &Updater{
+			CurrentVersion: "1.2",
+			Dir:            cmdName + "-update/",
+			CmdName:        cmdName,
+			Platform:       "linux-amd64",
+			Target:         filepath.Join(dir, cmdName+"-1.2"),
+			Source:         source,
+			ForceCheck:     true,
+		})
+	}
+
+	for _, updater := range updaters {
+		info, err := updater.BackgroundRun()
+		if err != nil {
+			t.Fatal(err)
+		}
+		equals(t, "1.3", info.Version)
+		bin, _ := ioutil.ReadFile(updater.Target)
+		equals(t, updater.CmdName+" 1.3", string(bin))
+		installed, _ := updater.InstalledInfo()
+		equals(t, "1.3", installed.Version)
+	}
+}
+
+func TestUpdaterPatchesVersionsThatDontCompare(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	release.publishVersions("linux-amd64", "9f3c2a1", "1b7e0d4")
+
+	updater := release.updater("9f3c2a1", []byte("binary 9f3c2a1"))
+	var full int
+	files := release.files()
+	release.serve(updater, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			full++
+		}
+		files.ServeHTTP(w, r)
+	}))
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, "1b7e0d4", info.Version)
+	bin, _ := ioutil.ReadFile(updater.Target)
+	equals(t, "binary 1b7e0d4", string(bin))
+	equals(t, 0, full)
+}
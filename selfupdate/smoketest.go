@@ -0,0 +1,59 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultSmokeTestTimeout = 10 * time.Second
+
+// smokeTest returns a check running a new binary of version info with
+// SmokeTestArgs before it is installed, or nil if no smoke test is
+// configured.
+func (u *Updater) smokeTest(info Info) func(path string) error {
+	if u.SmokeTestArgs == nil {
+		return nil
+	}
+	return func(path string) error {
+		timeout := u.SmokeTestTimeout
+		if timeout <= 0 {
+			timeout = defaultSmokeTestTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, path, u.SmokeTestArgs...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return fmt.Errorf("no exit within %v", timeout)
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		if u.SmokeTestVersion && !containsVersion(stdout.String(), info.Version) {
+			return fmt.Errorf("output %q doesn't contain version %s", strings.TrimSpace(stdout.String()), info.Version)
+		}
+		return nil
+	}
+}
+
+// containsVersion reports whether a word of output is version, like v1.3.0
+// for 1.3 but not 1.30 or 11.3.
+func containsVersion(output, version string) bool {
+	words := strings.FieldsFunc(output, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:()[]\"'", r)
+	})
+	for _, word := range words {
+		if compareVersions(word, version) == 0 {
+			return true
+		}
+	}
+	return false
+}
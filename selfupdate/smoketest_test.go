@@ -0,0 +1,59 @@
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestUpdaterSmokeTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts as binaries")
+	}
+	dir, err := ioutil.TempDir("", "selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "myapp")
+	old := "#!/bin/sh\necho 1.2\n"
+	ioutil.WriteFile(target, []byte(old), 0755)
+
+	updater := &Updater{
+		CurrentVersion:   "1.2",
+		Dir:              "update/",
+		Target:           target,
+		SmokeTestArgs:    []string{"--version"},
+		SmokeTestTimeout: time.Second,
+		SmokeTestVersion: true,
+	}
+	for _, bin := range []string{
+		"#!/bin/sh\nexit 1\n",
+		"#!/bin/sh\necho 1.4\n",
+		"#!/bin/sh\necho myapp 1.30 built with go1.3\n",
+		"#!/bin/sh\necho 11.3.0\n",
+		"#!/bin/sh\nexec sleep 5\n",
+		"not an executable",
+	} {
+		err := updater.install(context.Background(), []byte(bin), Info{Version: "1.3"})
+		var installErr *InstallError
+		if !errors.As(err, &installErr) || installErr.Op != "smoke test" {
+			t.Errorf("expected the smoke test of %q to fail, got %v", bin, err)
+		}
+		if got, _ := ioutil.ReadFile(target); string(got) != old {
+			t.Errorf("expected a failed smoke test to keep the target, got %q", got)
+		}
+	}
+
+	bin := "#!/bin/sh\n[ \"$1\" = --version ] && echo v1.3.0\n"
+	if err := updater.install(context.Background(), []byte(bin), Info{Version: "1.3"}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(target)
+	equals(t, bin, string(got))
+}
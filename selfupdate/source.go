@@ -0,0 +1,174 @@
+package selfupdate
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+)
+
+// ErrNoPatch is returned by a Source that has no patch between two versions.
+// The Updater then silently falls back to the full binary.
+var ErrNoPatch = errors.New("no patch available")
+
+// Source provides update manifests and binaries to an Updater. Everything a
+// Source returns is verified against the hash and signature of the Info
+// returned by FetchInfo before it is installed.
+//
+// If Updater.Source is nil the layout written by CreateUpdate is fetched
+// from ApiURL, DiffURL, BinURL and their mirrors using the Updater's
+// Requester.
+type Source interface {
+	// FetchInfo returns the manifest of the newest version of cmdName for
+	// platform. Sources that support release channels return the newest
+	// version on channel, an empty channel selects stable releases. An
+	// empty Info means no update is available.
+	FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error)
+	// FetchPatch returns a bsdiff patch transforming version from into
+	// version to, or ErrNoPatch.
+	FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error)
+	// FetchBin returns the uncompressed executable of version.
+	FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error)
+}
+
+// urlSource is the default Source reading the go-selfupdate layout from a
+// base URL like ApiURL using the Requester of the Updater.
+type urlSource struct {
+	u    *Updater
+	base string
+}
+
+// SizeSource is implemented by sources that can tell the download size of
+// patches and binaries without downloading them.
+type SizeSource interface {
+	Source
+	// PatchSize returns the size of the patch from version from to version
+	// to, or ErrNoPatch.
+	PatchSize(ctx context.Context, cmdName, from, to, platform string) (int64, error)
+	// BinSize returns the size of the download of version, -1 if unknown.
+	BinSize(ctx context.Context, cmdName, version, platform string) (int64, error)
+}
+
+// fetch fetches rawURL with the Requester of the Updater.
+func (s *urlSource) fetch(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	r, err := s.u.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return countDownload(ctx, r), nil
+}
+
+func (s *urlSource) FetchInfo(ctx context.Context, cmdName, platform, channel string) (Info, error) {
+	r, err := s.fetch(ctx, s.base+url.QueryEscape(cmdName)+"/"+url.QueryEscape(platform)+".json")
+	if err != nil {
+		return Info{}, err
+	}
+	defer r.Close()
+	return decodeInfo(r)
+}
+
+func (s *urlSource) FetchIndex(ctx context.Context, cmdName string) ([]byte, []byte, error) {
+	index, err := s.readAll(ctx, s.indexURL(cmdName, indexPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := s.readAll(ctx, s.indexURL(cmdName, indexSignaturePath))
+	if err != nil && !isNotFound(err) {
+		return nil, nil, err
+	}
+	return index, sig, nil
+}
+
+func (s *urlSource) readAll(ctx context.Context, rawURL string) ([]byte, error) {
+	r, err := s.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (s *urlSource) FetchPatch(ctx context.Context, cmdName, from, to, platform string) (io.ReadCloser, error) {
+	if s.base == "" {
+		return nil, ErrNoPatch
+	}
+	r, err := s.fetch(ctx, s.patchURL(cmdName, from, to, platform))
+	// patches are optional, a missing one isn't a failure of the server
+	if isNotFound(err) {
+		return nil, ErrNoPatch
+	}
+	return r, err
+}
+
+func (s *urlSource) FetchBin(ctx context.Context, cmdName, version, platform string) (io.ReadCloser, error) {
+	r, err := s.fetch(ctx, s.binURL(cmdName, version, platform))
+	if err != nil {
+		return nil, err
+	}
+	return gunzip(r)
+}
+
+// PatchSize asks for the size with a HEAD request. Other requesters than an
+// HTTPRequester can only fetch, so the patch is downloaded and counted.
+func (s *urlSource) PatchSize(ctx context.Context, cmdName, from, to, platform string) (int64, error) {
+	if s.base == "" {
+		return 0, ErrNoPatch
+	}
+	size, ok, err := s.u.contentLength(s.patchURL(cmdName, from, to, platform))
+	if !ok {
+		var r io.ReadCloser
+		if r, err = s.FetchPatch(ctx, cmdName, from, to, platform); err == nil {
+			defer r.Close()
+			size, err = io.Copy(ioutil.Discard, r)
+		}
+	}
+	if isNotFound(err) {
+		return 0, ErrNoPatch
+	}
+	return size, err
+}
+
+// BinSize asks for the size of the gzipped binary with a HEAD request. It is
+// unknown with other requesters than an HTTPRequester.
+func (s *urlSource) BinSize(ctx context.Context, cmdName, version, platform string) (int64, error) {
+	size, ok, err := s.u.contentLength(s.binURL(cmdName, version, platform))
+	if !ok {
+		return -1, nil
+	}
+	return size, err
+}
+
+func (s *urlSource) patchURL(cmdName, from, to, platform string) string {
+	return s.base + url.QueryEscape(cmdName) + "/" + url.QueryEscape(from) + "/" + url.QueryEscape(to) + "/" + url.QueryEscape(platform)
+}
+
+func (s *urlSource) indexURL(cmdName, name string) string {
+	return s.base + url.QueryEscape(cmdName) + "/" + name
+}
+
+func (s *urlSource) binURL(cmdName, version, platform string) string {
+	return s.base + url.QueryEscape(cmdName) + "/" + url.QueryEscape(version) + "/" + url.QueryEscape(platform) + ".gz"
+}
+
+// decodeInfo decodes a manifest like the platform.json files written by
+// CreateUpdate.
+func decodeInfo(r io.Reader) (Info, error) {
+	info := Info{}
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// gunzip returns a reader decompressing r. Closing it closes r.
+func gunzip(r io.ReadCloser) (io.ReadCloser, error) {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return &gzReader{z: z, r: r}, nil
+}
@@ -0,0 +1,124 @@
+package selfupdate
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Tracer records spans for the phases of updates, like fetching the
+// manifest, downloading the patch or installing. It keeps tracing libraries
+// out of the package: the selfupdate/otel package implements it with
+// OpenTelemetry.
+type Tracer interface {
+	// Start starts the span name as a child of the span of ctx, if any, and
+	// returns a context holding it.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	// Inject adds the span of ctx to the headers of a request, so servers
+	// can continue the trace.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attrs to the span, replacing those with the same
+	// keys.
+	SetAttributes(attrs ...Attribute)
+	// End ends the span, which failed if err is set.
+	End(err error)
+}
+
+// Attribute is a key value pair describing a span, like
+// selfupdate.version=1.3. Value is a string or an int64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// attributeKey is the key of an Attribute.
+type attributeKey string
+
+func (k attributeKey) String(v string) Attribute {
+	return Attribute{Key: string(k), Value: v}
+}
+
+func (k attributeKey) Int(v int) Attribute {
+	return Attribute{Key: string(k), Value: int64(v)}
+}
+
+// Attributes of the spans of an Updater.
+const (
+	attrCurrentVersion attributeKey = "selfupdate.current_version"
+	attrVersion        attributeKey = "selfupdate.version"
+	attrPlatform       attributeKey = "selfupdate.platform"
+	attrSource         attributeKey = "selfupdate.source"
+	attrBytes          attributeKey = "selfupdate.bytes"
+	attrFallback       attributeKey = "selfupdate.fallback_reason"
+	attrResult         attributeKey = "selfupdate.result"
+)
+
+// traceKey is the context key of the current span and its Tracer.
+type traceKey struct{}
+
+type traceContext struct {
+	tracer Tracer
+	span   Span
+}
+
+// noopSpan is started without Tracer.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) End(error)                  {}
+
+// startSpan starts a span of the Tracer, if one is set.
+func (u *Updater) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if u.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := u.Tracer.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, traceKey{}, traceContext{tracer: u.Tracer, span: span}), span
+}
+
+// spanFromContext returns the current span of ctx.
+func spanFromContext(ctx context.Context) Span {
+	if tc, ok := ctx.Value(traceKey{}).(traceContext); ok {
+		return tc.span
+	}
+	return noopSpan{}
+}
+
+// fallbackReason describes why a patch couldn't be used.
+func fallbackReason(err error) string {
+	switch err {
+	case ErrNoPatch:
+		return "no_patch"
+	case ErrHashMismatch:
+		return "hash_mismatch"
+	case ErrSignatureMismatch:
+		return "signature_mismatch"
+	}
+	return "patch_failed"
+}
+
+// injectTrace adds the current span of ctx to the headers of req.
+func injectTrace(ctx context.Context, req *http.Request) {
+	if tc, ok := ctx.Value(traceKey{}).(traceContext); ok {
+		tc.tracer.Inject(ctx, req.Header)
+	}
+}
+
+// startUpdateSpan starts the span of an update of the current version.
+func (u *Updater) startUpdateSpan(ctx context.Context, name string) (context.Context, Span) {
+	return u.startSpan(ctx, name, attrCurrentVersion.String(u.CurrentVersion), attrPlatform.String(u.getPlatform()))
+}
+
+// endUpdate records and reports the result of an update to target started
+// at start, which returned info and err, and ends its span.
+func (u *Updater) endUpdate(span Span, start time.Time, target, info Info, err error) {
+	result := resultOf(info, err, u.DryRun, u.DeferApply)
+	u.recordResult(result, info)
+	u.reportApply(start, target, result, err)
+	span.SetAttributes(attrVersion.String(target.Version), attrResult.String(result))
+	span.End(err)
+}
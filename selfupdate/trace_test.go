@@ -0,0 +1,107 @@
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestUpdaterTracesPhases(t *testing.T) {
+	release := newTestRelease(t, "myapp")
+	oldBin := bytes.Repeat([]byte("old binary "), 100)
+	release.publish(Info{Version: "1.2"}, "linux-amd64", oldBin)
+	release.publish(Info{Version: "1.3"}, "linux-amd64", []byte("new binary"))
+	patch := release.breakPatch("1.2", "1.3", "linux-amd64", oldBin)
+
+	tracer := &testTracer{spans: map[string]*testSpan{}}
+	updater := release.updater("1.2", oldBin)
+	updater.Tracer = tracer
+	var mu sync.Mutex
+	var traces []string
+	files := release.files()
+	release.serve(updater, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traces = append(traces, r.Header.Get("X-Test-Trace"))
+		mu.Unlock()
+		files.ServeHTTP(w, r)
+	}))
+	if _, err := updater.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.spans
+	for _, name := range []string{"selfupdate.Update", "selfupdate.FetchManifest", "selfupdate.DownloadPatch",
+		"selfupdate.ApplyPatch", "selfupdate.Verify", "selfupdate.DownloadFull", "selfupdate.Install"} {
+		if span, ok := spans[name]; !ok || !span.ended {
+			t.Errorf("expected a span %s", name)
+		}
+	}
+	update := spans["selfupdate.Update"]
+	equals(t, "1.3", update.attrs[string(attrVersion)])
+	equals(t, "linux-amd64", update.attrs[string(attrPlatform)])
+	equals(t, "hash_mismatch", update.attrs[string(attrFallback)])
+	equals(t, ResultUpdated, update.attrs[string(attrResult)])
+	equals(t, int64(len(patch)), spans["selfupdate.DownloadPatch"].attrs[string(attrBytes)])
+	if install := spans["selfupdate.Install"]; install == nil || install.root() != update {
+		t.Error("expected selfupdate.Install to be part of selfupdate.Update")
+	}
+
+	equals(t, 3, len(traces))
+	for _, trace := range traces {
+		if trace != "selfupdate.Update" {
+			t.Errorf("expected the requests to carry the trace, got %q", trace)
+		}
+	}
+}
+
+// testTracer records the last span of each name.
+type testTracer struct {
+	mu    sync.Mutex
+	spans map[string]*testSpan
+}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: map[string]interface{}{}}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans[name] = span
+	t.mu.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+// Inject sends the name of the root span.
+func (t *testTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		header.Set("X-Test-Trace", span.root().name)
+	}
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.err, s.ended = err, true
+}
+
+func (s *testSpan) root() *testSpan {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
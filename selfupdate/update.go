@@ -54,7 +54,10 @@ func GenerateSha256(path string) []byte {
 }
 
 func CreateUpdate(version Info, path string, platform string, genDir string, pk *rsa.PrivateKey) {
-	c := Info{Version: version.Version, Sha256: GenerateSha256(path)}
+	c := version
+	c.Sha256, c.Signature = GenerateSha256(path), nil
+	c.Size, c.PatchSizes = 0, nil
+	c.Platform = platform
 	if pk != nil {
 		sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, c.Sha256)
 		if err != nil {
@@ -62,14 +65,6 @@ func CreateUpdate(version Info, path string, platform string, genDir string, pk
 		}
 		c.Signature = sig
 	}
-	b, err := json.MarshalIndent(c, "", "    ")
-	if err != nil {
-		fmt.Println("error:", err)
-	}
-	err = ioutil.WriteFile(filepath.Join(genDir, platform+".json"), b, 0755)
-	if err != nil {
-		panic(err)
-	}
 
 	os.MkdirAll(filepath.Join(genDir, version.Version), 0755)
 
@@ -82,6 +77,7 @@ func CreateUpdate(version Info, path string, platform string, genDir string, pk
 	w.Write(f)
 	w.Close() // You must close this first to flush the bytes to the buffer.
 	err = ioutil.WriteFile(filepath.Join(genDir, version.Version, platform+".gz"), buf.Bytes(), 0755)
+	c.Size = int64(buf.Len())
 
 	files, err := ioutil.ReadDir(genDir)
 	if err != nil {
@@ -121,5 +117,22 @@ func CreateUpdate(version Info, path string, platform string, genDir string, pk
 			panic(err)
 		}
 		ioutil.WriteFile(filepath.Join(genDir, file.Name(), version.Version, platform), patch.Bytes(), 0755)
+		if c.PatchSizes == nil {
+			c.PatchSizes = map[string]int64{}
+		}
+		c.PatchSizes[file.Name()] = int64(patch.Len())
+	}
+
+	// the manifest is written last, so it only announces complete updates
+	b, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		fmt.Println("error:", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(genDir, platform+".json"), b, 0755)
+	if err != nil {
+		panic(err)
+	}
+	if err := indexPlatform(genDir, platform, c, pk); err != nil {
+		panic(err)
 	}
 }
@@ -0,0 +1,106 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kr/binarydist"
+)
+
+// testRelease is a temporary directory with the updates of a command
+// published by CreateUpdate, like a release server would serve them.
+type testRelease struct {
+	t       *testing.T
+	dir     string          // Directory of the binaries and of public/, removed after the test.
+	genDir  string          // Directory of the updates of cmdName in public/.
+	cmdName string          // Command the updates are published for.
+	key     *rsa.PrivateKey // Optional key to sign the updates with.
+}
+
+// newTestRelease creates an empty release of cmdName.
+func newTestRelease(t *testing.T, cmdName string) *testRelease {
+	dir := t.TempDir()
+	genDir := filepath.Join(dir, "public", cmdName)
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &testRelease{t: t, dir: dir, genDir: genDir, cmdName: cmdName}
+}
+
+// publish publishes bin as the version of info for platform.
+func (r *testRelease) publish(info Info, platform string, bin []byte) {
+	path := filepath.Join(r.dir, r.cmdName+"-"+info.Version+"-"+platform)
+	if err := ioutil.WriteFile(path, bin, 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	CreateUpdate(info, path, platform, r.genDir, r.key)
+}
+
+// publishVersions publishes the binaries "binary <version>" of versions
+// for platform, in order.
+func (r *testRelease) publishVersions(platform string, versions ...string) {
+	for _, version := range versions {
+		r.publish(Info{Version: version}, platform, []byte("binary "+version))
+	}
+}
+
+// breakPatch replaces the patch from one version to another with a patch
+// of old resulting in the wrong binary, and returns it.
+func (r *testRelease) breakPatch(from, to, platform string, old []byte) []byte {
+	var patch bytes.Buffer
+	if err := binarydist.Diff(bytes.NewReader(old), bytes.NewReader([]byte("bad binary")), &patch); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.genDir, from, to, platform), patch.Bytes(), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+	return patch.Bytes()
+}
+
+// source returns a Source reading the release from disk.
+func (r *testRelease) source() *FSSource {
+	return &FSSource{FS: os.DirFS(filepath.Join(r.dir, "public"))}
+}
+
+// files returns a handler serving the release over HTTP.
+func (r *testRelease) files() http.Handler {
+	return http.FileServer(http.Dir(filepath.Join(r.dir, "public")))
+}
+
+// serve serves h until the end of the test and points the URLs of u at it
+// instead of its Source. It returns the URL u fetches from.
+func (r *testRelease) serve(u *Updater, h http.Handler) string {
+	server := httptest.NewServer(h)
+	r.t.Cleanup(server.Close)
+	url := server.URL + "/"
+	u.ApiURL, u.BinURL, u.DiffURL, u.Source = url, url, url, nil
+	return url
+}
+
+// updater returns an Updater of a target running version with bin,
+// reading the release from disk.
+func (r *testRelease) updater(version string, bin []byte) *Updater {
+	target := filepath.Join(r.dir, r.cmdName)
+	if err := ioutil.WriteFile(target, bin, 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	u := &Updater{
+		CurrentVersion: version,
+		Dir:            "update/",
+		CmdName:        r.cmdName,
+		Platform:       "linux-amd64",
+		Target:         target,
+		Source:         r.source(),
+		PolicyFile:     filepath.Join(r.dir, "policy.json"),
+	}
+	if r.key != nil {
+		u.PublicKey = &r.key.PublicKey
+	}
+	return u
+}
@@ -0,0 +1,183 @@
+package selfupdate
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/cpu"
+)
+
+// Platforms may carry a variant after GOOS-GOARCH. It names the CPU feature
+// level the binary was built for, like v3 for GOAMD64=v3 or v7 for GOARM=7,
+// the libc of cgo binaries, glibc or musl, or both like linux-arm-v7-musl.
+const (
+	libcGlibc = "glibc"
+	libcMusl  = "musl"
+)
+
+// hostVariants returns the CPU feature levels, best first, and the libc of
+// the machine.
+var hostVariants = func() ([]string, string) {
+	return cpuLevels(runtime.GOARCH), hostLibc()
+}
+
+// splitVariant splits a platform like linux-amd64-v3 into linux-amd64 and
+// its variant v3.
+func splitVariant(platform string) (string, string) {
+	parts := strings.SplitN(platform, "-", 3)
+	if len(parts) < 3 {
+		return platform, ""
+	}
+	return parts[0] + "-" + parts[1], parts[2]
+}
+
+// platformVariants returns the variants of platform a machine with the given
+// CPU levels and libc can run, best first. Binaries for the libc come before
+// binaries without libc suffix, which are expected to be statically linked,
+// and the platform itself comes last.
+func platformVariants(platform string, levels []string, libc string) []string {
+	libcs := []string{""}
+	if libc != "" {
+		libcs = []string{libc, ""}
+	}
+	var platforms []string
+	for _, libc := range libcs {
+		for _, level := range levels {
+			platforms = append(platforms, joinVariant(platform, level, libc))
+		}
+		platforms = append(platforms, joinVariant(platform, "", libc))
+	}
+	return platforms
+}
+
+func joinVariant(platform string, variants ...string) string {
+	for _, v := range variants {
+		if v != "" {
+			platform += "-" + v
+		}
+	}
+	return platform
+}
+
+// platforms returns the platforms to look for updates, best first. Only
+// with Variants the machine is inspected, and only if the platform is the
+// one the process runs on and names no variant itself.
+func (u *Updater) platforms() []string {
+	platform := u.getPlatform()
+	if !u.Variants {
+		return []string{platform}
+	}
+	base, variant := splitVariant(platform)
+	if variant != "" || base != runtime.GOOS+"-"+runtime.GOARCH {
+		return []string{platform}
+	}
+	levels, libc := hostVariants()
+	return platformVariants(platform, levels, libc)
+}
+
+// platformFor returns the platform info was published for.
+func (u *Updater) platformFor(info Info) string {
+	if info.Platform != "" {
+		return info.Platform
+	}
+	return u.getPlatform()
+}
+
+// isMissing reports whether err means a file doesn't exist.
+func isMissing(err error) bool {
+	return isNotFound(err) || errors.Is(err, fs.ErrNotExist)
+}
+
+// notExistError is a file missing from a release. It matches
+// fs.ErrNotExist, so variants that aren't published are skipped.
+type notExistError struct {
+	msg string
+}
+
+func notExist(format string, args ...interface{}) error {
+	return &notExistError{msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *notExistError) Error() string {
+	return e.msg
+}
+
+func (e *notExistError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// cpuLevels returns the feature levels of the CPU, best first, as named by
+// GOAMD64 and GOARM. v1 is left out for amd64 since it is the default.
+func cpuLevels(goarch string) []string {
+	var levels []string
+	switch goarch {
+	case "amd64":
+		x := cpu.X86
+		v2 := x.HasCX16 && x.HasPOPCNT && x.HasSSE3 && x.HasSSSE3 && x.HasSSE41 && x.HasSSE42
+		v3 := v2 && x.HasAVX && x.HasAVX2 && x.HasBMI1 && x.HasBMI2 && x.HasFMA && x.HasOSXSAVE
+		v4 := v3 && x.HasAVX512F && x.HasAVX512BW && x.HasAVX512CD && x.HasAVX512DQ && x.HasAVX512VL
+		for _, level := range []struct {
+			name string
+			ok   bool
+		}{{"v4", v4}, {"v3", v3}, {"v2", v2}} {
+			if level.ok {
+				levels = append(levels, level.name)
+			}
+		}
+	case "arm":
+		if cpu.ARM.HasVFPv3 {
+			levels = append(levels, "v7")
+		}
+		if cpu.ARM.HasVFP {
+			levels = append(levels, "v6")
+		}
+		levels = append(levels, "v5")
+	}
+	return levels
+}
+
+// hostLibc returns the libc of a linux machine, which is the one of the
+// running executable if it is linked dynamically. Otherwise it depends on
+// the dynamic loaders installed.
+func hostLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	if f, err := elf.Open("/proc/self/exe"); err == nil {
+		defer f.Close()
+		for _, prog := range f.Progs {
+			if prog.Type != elf.PT_INTERP {
+				continue
+			}
+			if interp, err := ioutil.ReadAll(prog.Open()); err == nil {
+				if libc := libcOf(strings.TrimRight(string(interp), "\x00")); libc != "" {
+					return libc
+				}
+			}
+		}
+	}
+	for _, pattern := range []string{"/lib*/ld-linux*.so.*", "/lib*/ld64.so.*", "/lib/ld-musl-*.so.*"} {
+		if loaders, _ := filepath.Glob(pattern); len(loaders) > 0 {
+			return libcOf(loaders[0])
+		}
+	}
+	return ""
+}
+
+// libcOf returns the libc of a dynamic loader like /lib/ld-musl-x86_64.so.1.
+func libcOf(loader string) string {
+	name := filepath.Base(loader)
+	switch {
+	case strings.HasPrefix(name, "ld-musl-"):
+		return libcMusl
+	case strings.HasPrefix(name, "ld-linux"), strings.HasPrefix(name, "ld64.so"):
+		return libcGlibc
+	}
+	return ""
+}
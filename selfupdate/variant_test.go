@@ -0,0 +1,65 @@
+package selfupdate
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPlatformVariants(t *testing.T) {
+	equals(t, "linux-amd64", strings.Join(platformVariants("linux-amd64", nil, ""), " "))
+	equals(t, "linux-amd64-v3 linux-amd64-v2 linux-amd64", strings.Join(platformVariants("linux-amd64", []string{"v3", "v2"}, ""), " "))
+	equals(t, "linux-arm-v7-musl linux-arm-v6-musl linux-arm-musl linux-arm-v7 linux-arm-v6 linux-arm",
+		strings.Join(platformVariants("linux-arm", []string{"v7", "v6"}, "musl"), " "))
+
+	base, variant := splitVariant("linux-arm-v7-musl")
+	equals(t, "linux-arm", base)
+	equals(t, "v7-musl", variant)
+	goos, goarch := splitPlatform("linux-arm-v7-musl")
+	equals(t, "linux", goos)
+	equals(t, "arm", goarch)
+
+	equals(t, "musl", libcOf("/lib/ld-musl-x86_64.so.1"))
+	equals(t, "glibc", libcOf("/lib64/ld-linux-x86-64.so.2"))
+	equals(t, "", libcOf("/lib/ld.so"))
+
+	if err := CheckPlatform(bytes.NewReader(elfHeader(elf.EM_X86_64, elf.ELFOSABI_NONE)), "linux-amd64-v3-glibc"); err != nil {
+		t.Errorf("expected a variant to match its platform, got %v", err)
+	}
+}
+
+func TestUpdaterPrefersVariants(t *testing.T) {
+	defer func(detect func() ([]string, string)) { hostVariants = detect }(hostVariants)
+	hostVariants = func() ([]string, string) { return []string{"v3", "v2"}, "musl" }
+
+	release := newTestRelease(t, "myapp")
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	for _, variant := range []string{"", "-v2", "-v4", "-v3-glibc"} {
+		release.publish(Info{Version: "1.3"}, platform+variant, []byte("binary for"+variant))
+	}
+
+	updater := release.updater("1.2", []byte("old binary"))
+	updater.Platform = ""
+	target := updater.Target
+	info, err := updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, platform, info.Platform)
+
+	ioutil.WriteFile(target, []byte("old binary"), 0755)
+	updater.Variants = true
+	info, err = updater.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(t, platform+"-v2", info.Platform)
+	if bin, _ := ioutil.ReadFile(target); !strings.HasSuffix(string(bin), "-v2") {
+		t.Errorf("expected the v2 binary to be installed, got %q", bin)
+	}
+	installed, _ := updater.InstalledInfo()
+	equals(t, platform+"-v2", installed.Platform)
+}
@@ -0,0 +1,159 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compareVersions compares two versions like 1.2.3 or v1.3.0-beta.1 and
+// returns -1, 0 or 1 if a is older than, equal to or newer than b.
+//
+// Dot separated parts are compared numerically if both are numbers and
+// lexically otherwise, missing parts count as 0. A version with a
+// pre-release suffix is older than the same version without. Build metadata
+// after a + is ignored.
+func compareVersions(a, b string) int {
+	a, aPre := splitVersion(a)
+	b, bPre := splitVersion(b)
+	if c := compareParts(strings.Split(a, "."), strings.Split(b, "."), "0"); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareParts(strings.Split(aPre, "."), strings.Split(bPre, "."), "")
+}
+
+// splitVersion strips a v prefix and build metadata from version and splits
+// off the pre-release suffix.
+func splitVersion(version string) (string, string) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		return version[:i], version[i+1:]
+	}
+	return version, ""
+}
+
+func compareParts(a, b []string, missing string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := missing, missing
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := comparePart(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// comparePart compares numbers numerically, and numbers as older than other
+// parts like in semantic versioning. A missing part is older than any other.
+func comparePart(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// parsePin returns a function reporting whether a version matches pin. A
+// pin is a version like 1.4.2, a wildcard like 1.4.x or constraints like
+// ">=1.4, <1.5" that must all hold. Constraints compare with =, !=, <, <=,
+// > or >= and are separated by commas or spaces.
+func parsePin(pin string) (func(version string) bool, error) {
+	fields := strings.FieldsFunc(pin, func(r rune) bool { return r == ',' || r == ' ' })
+	var checks []func(string) bool
+	for i := 0; i < len(fields); i++ {
+		constraint := fields[i]
+		// allow a space between operator and version like ">= 1.4"
+		if strings.Trim(constraint, "<>=!") == "" && i+1 < len(fields) {
+			i++
+			constraint += fields[i]
+		}
+		check, err := parseConstraint(constraint)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("pin %q names no version", pin)
+	}
+	return func(version string) bool {
+		for _, check := range checks {
+			if !check(version) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func parseConstraint(constraint string) (func(string) bool, error) {
+	version := strings.TrimLeft(constraint, "<>=!")
+	op := constraint[:len(constraint)-len(version)]
+	if v := strings.TrimPrefix(version, "v"); v == "" || v[0] < '0' || v[0] > '9' {
+		return nil, fmt.Errorf("constraint %q names no version", constraint)
+	}
+	for _, wildcard := range []string{".x", ".X", ".*"} {
+		if !strings.HasSuffix(version, wildcard) {
+			continue
+		}
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("constraint %q can't compare with a wildcard", constraint)
+		}
+		prefix, _ := splitVersion(strings.TrimSuffix(version, wildcard))
+		return func(v string) bool {
+			v, _ = splitVersion(v)
+			return v == prefix || strings.HasPrefix(v, prefix+".")
+		}, nil
+	}
+	results := map[string]func(int) bool{
+		"":   func(c int) bool { return c == 0 },
+		"=":  func(c int) bool { return c == 0 },
+		"==": func(c int) bool { return c == 0 },
+		"!=": func(c int) bool { return c != 0 },
+		"<":  func(c int) bool { return c < 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		">":  func(c int) bool { return c > 0 },
+		">=": func(c int) bool { return c >= 0 },
+	}
+	result, ok := results[op]
+	if !ok {
+		return nil, fmt.Errorf("constraint %q has unknown operator %s", constraint, op)
+	}
+	return func(v string) bool { return result(compareVersions(v, version)) }, nil
+}
@@ -0,0 +1,63 @@
+package selfupdate
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.2", "1.2", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.3", "1.3", 0},
+		{"1.3+build.5", "1.3", 0},
+		{"1.10", "1.9", 1},
+		{"1.2", "1.3", -1},
+		{"2.0", "1.99.99", 1},
+		{"1.3-beta.1", "1.3", -1},
+		{"1.3-beta.2", "1.3-beta.1", 1},
+		{"1.3-beta.10", "1.3-beta.9", 1},
+		{"1.3-beta", "1.3-beta.1", -1},
+		{"1.3-rc.1", "1.3-beta.5", 1},
+		{"1.3-1", "1.3-alpha", -1},
+	} {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d; want %d", test.a, test.b, got, test.want)
+		}
+		if got := compareVersions(test.b, test.a); got != -test.want {
+			t.Errorf("compareVersions(%q, %q) = %d; want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	for _, test := range []struct {
+		pin, version string
+		want         bool
+	}{
+		{"1.4.2", "1.4.2", true},
+		{"1.4.2", "v1.4.2", true},
+		{"1.4.2", "1.4.3", false},
+		{"1.4.x", "1.4.9", true},
+		{"1.4.*", "1.4", true},
+		{"1.4.x", "1.40", false},
+		{">=1.4, <1.5", "1.4.7", true},
+		{">=1.4, <1.5", "1.5", false},
+		{">= 1.4 < 1.5", "1.3.9", false},
+		{"!=1.4.1", "1.4.1", false},
+	} {
+		matches, err := parsePin(test.pin)
+		if err != nil {
+			t.Errorf("parsePin(%q) failed: %v", test.pin, err)
+			continue
+		}
+		if got := matches(test.version); got != test.want {
+			t.Errorf("pin %q matches %q = %v; want %v", test.pin, test.version, got, test.want)
+		}
+	}
+	for _, pin := range []string{"", ">=", "~1.4", ">1.4.x"} {
+		if _, err := parsePin(pin); err == nil {
+			t.Errorf("expected parsePin(%q) to fail", pin)
+		}
+	}
+}